@@ -56,7 +56,7 @@ func (buf *buffer) clone() *buffer {
 func (buf *buffer) push(value, weight float64) error {
 	//QCHECK magic
 	if buf.isFull() {
-		return fmt.Errorf("Buffer already full: %v", buf.maxSize)
+		return fmt.Errorf("%w: %v", errBufferFull, buf.maxSize)
 	}
 
 	if weight > 0 {
@@ -66,6 +66,13 @@ func (buf *buffer) push(value, weight float64) error {
 	return nil
 }
 
+// scale multiplies the weights of all buffered entries by factor.
+func (buf *buffer) scale(factor float64) {
+	for i := range buf.vec[:buf.curSize] {
+		buf.vec[i].weight *= factor
+	}
+}
+
 // generateEntryList returns a sorted vector view of the base buffer and clears the buffer.
 // Callers should minimize how often this is called, ideally only right after
 // the buffer becomes full.
@@ -0,0 +1,134 @@
+package quantiles
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Violation is an invariant violated by a summary.
+type Violation struct {
+	// Entry is the index of the offending entry, or -1 if the violation
+	// concerns the summary as a whole.
+	Entry  int
+	Reason string
+}
+
+func (v Violation) Error() string {
+	if v.Entry < 0 {
+		return v.Reason
+	}
+	return fmt.Sprintf("entry %v: %v", v.Entry, v.Reason)
+}
+
+// CheckError lists every invariant violated by a summary.
+type CheckError struct {
+	Violations []Violation
+}
+
+func (e *CheckError) Error() string {
+	reasons := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		reasons[i] = v.Error()
+	}
+	return fmt.Sprintf("summary violates %v invariants: %v", len(e.Violations), strings.Join(reasons, "; "))
+}
+
+// check lists the violated invariants of a single entry.
+func (se SumEntry) check(tol float64) []string {
+	var reasons []string
+	if se.value != se.value {
+		reasons = append(reasons, "value is NaN")
+	}
+	if !(se.weight >= 0) || math.IsInf(se.weight, 1) {
+		reasons = append(reasons, fmt.Sprintf("invalid weight %v", se.weight))
+	}
+	if !(se.minRank >= 0) || math.IsInf(se.minRank, 1) {
+		reasons = append(reasons, fmt.Sprintf("invalid minRank %v", se.minRank))
+	}
+	if se.maxRank != se.maxRank || math.IsInf(se.maxRank, 0) {
+		reasons = append(reasons, fmt.Sprintf("invalid maxRank %v", se.maxRank))
+	} else if !(se.nextMinRank() <= se.maxRank+tol) {
+		reasons = append(reasons, fmt.Sprintf("minRank %v + weight %v exceeds maxRank %v", se.minRank, se.weight, se.maxRank))
+	}
+	return reasons
+}
+
+// checkEntries lists the violated invariants of a list of summary entries, see validateEntries.
+func checkEntries(entries []SumEntry) []Violation {
+	if len(entries) == 0 {
+		return nil
+	}
+	var violations []Violation
+	tol := rankTolerance * maxFloat64(1, entries[len(entries)-1].maxRank)
+	for i, e := range entries {
+		for _, reason := range e.check(tol) {
+			violations = append(violations, Violation{i, reason})
+		}
+		if i == 0 {
+			continue
+		}
+		prev := entries[i-1]
+		if e.value < prev.value {
+			violations = append(violations, Violation{i,
+				fmt.Sprintf("value %v is smaller than previous value %v", e.value, prev.value)})
+		}
+		if e.minRank < prev.nextMinRank()-tol {
+			violations = append(violations, Violation{i,
+				fmt.Sprintf("minRank %v is smaller than previous minRank + weight %v", e.minRank, prev.nextMinRank())})
+		}
+		if e.prevMaxRank() < prev.maxRank-tol {
+			violations = append(violations, Violation{i,
+				fmt.Sprintf("maxRank - weight %v is smaller than previous maxRank %v", e.prevMaxRank(), prev.maxRank)})
+		}
+	}
+	return violations
+}
+
+/*
+Check verifies the invariants of the summary: entries sorted by value,
+non-negative weights, minRank <= maxRank - weight, monotone ranks, a
+total weight of at least the sum of the entries' weights and a count of
+at least one element per weighted entry. If maxError is positive, the
+approximation error must not exceed it either.
+Zero-weight entries are valid, they pin a value to a known rank without
+standing for any element. Summaries rebuilt from quantiles, e.g. by
+ParseText, NewSummaryFromHistogram or convert.FromCentroids, consist of
+them.
+Summaries received over the wire or built by hand should be checked, as
+violating summaries produce meaningless quantiles. The returned error is
+a *CheckError listing every violation.
+*/
+func (sum *Summary) Check(maxError float64) error {
+	violations := checkEntries(sum.entries)
+	var weights float64
+	var weighted uint64
+	for _, e := range sum.entries {
+		if e.weight > 0 {
+			weights += e.weight
+			weighted++
+		}
+	}
+	if len(sum.entries) > 0 {
+		totalWeight := sum.TotalWeight()
+		if !(weights <= totalWeight*(1+rankTolerance)) {
+			violations = append(violations, Violation{-1,
+				fmt.Sprintf("total weight %v is smaller than the sum of weights %v", totalWeight, weights)})
+		}
+		if weighted > sum.n {
+			violations = append(violations, Violation{-1,
+				fmt.Sprintf("count %v is smaller than the number of weighted entries %v", sum.n, weighted)})
+		}
+	}
+	// The approximation error is only meaningful for valid entries.
+	if len(violations) == 0 {
+		if err := sum.ApproximationError(); maxError > 0 && err > maxError {
+			violations = append(violations, Violation{-1,
+				fmt.Sprintf("approximation error %v exceeds %v", err, maxError)})
+		}
+	}
+	if len(violations) > 0 {
+		return &CheckError{violations}
+	}
+	return nil
+}
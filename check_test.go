@@ -0,0 +1,93 @@
+package quantiles
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummaryCheck(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 10000)
+	assert.NoError(err)
+	for i := 0; i < 10000; i++ {
+		assert.NoError(stream.Push(float64(i%100), 1))
+	}
+	assert.NoError(stream.Finalize())
+	sum, err := stream.FinalSummary()
+	assert.NoError(err)
+	assert.NoError(sum.Check(0))
+	assert.NoError(sum.Check(0.01))
+	assert.NoError(newSummary().Check(0.01))
+
+	// A compressed summary is valid but less accurate.
+	lossy := sum.clone()
+	assert.NoError(lossy.Compress(0.1))
+	assert.NoError(lossy.Check(0))
+	err = lossy.Check(lossy.ApproximationError() / 2)
+	if assert.Error(err) {
+		checkErr, ok := err.(*CheckError)
+		assert.True(ok)
+		assert.Equal(1, len(checkErr.Violations))
+		assert.Equal(-1, checkErr.Violations[0].Entry)
+	}
+}
+
+func TestSummaryCheckViolations(t *testing.T) {
+	assert := assert.New(t)
+	sum := &Summary{entries: []SumEntry{
+		{value: 1, weight: 1, minRank: 0, maxRank: 1},
+		{value: math.NaN(), weight: -1, minRank: 1, maxRank: 2},
+		{value: 3, weight: 1, minRank: 2, maxRank: 2.5},
+		{value: 2, weight: 1, minRank: 0.5, maxRank: math.Inf(1)},
+		{value: 5, weight: 1, minRank: 4, maxRank: 5},
+	}, n: 5}
+
+	err := sum.Check(0)
+	if !assert.Error(err) {
+		return
+	}
+	checkErr, ok := err.(*CheckError)
+	if !assert.True(ok) {
+		return
+	}
+	var entries []int
+	for _, v := range checkErr.Violations {
+		entries = append(entries, v.Entry)
+	}
+	assert.Equal([]int{1, 1, 2, 2, 3, 3, 3, 4}, entries)
+	assert.Equal(Violation{1, "value is NaN"}, checkErr.Violations[0])
+	assert.Equal("entry 2: minRank 2 + weight 1 exceeds maxRank 2.5", checkErr.Violations[2].Error())
+	assert.Equal("entry 3: value 2 is smaller than previous value 3", checkErr.Violations[5].Error())
+	assert.Contains(err.Error(), "summary violates 8 invariants: entry 1: value is NaN; entry 1: invalid weight -1; ")
+
+	// validateEntries reports the first violation.
+	assert.Equal(checkErr.Violations[0], validateEntries(sum.entries))
+
+	// The total weight must cover the weights of all entries, even if the
+	// entries are invalid themselves.
+	sum = &Summary{entries: []SumEntry{
+		{value: 1, weight: 2, minRank: 0, maxRank: 2},
+		{value: 2, weight: 2, minRank: 2, maxRank: 2},
+	}, n: 4}
+	err = sum.Check(0)
+	assert.Error(err)
+	assert.Contains(err.Error(), "entry 1: minRank 2 + weight 2 exceeds maxRank 2")
+	assert.Contains(err.Error(), "total weight 2 is smaller than the sum of weights 4")
+
+	// Zero-weight entries pin a rank, every weighted entry stands for at
+	// least one element.
+	sum = &Summary{entries: []SumEntry{
+		{value: 1, weight: 1, minRank: 0, maxRank: 1},
+		{value: 2, weight: 0, minRank: 1, maxRank: 1},
+	}, n: 1}
+	assert.NoError(sum.Check(0))
+	sum.entries = append(sum.entries, SumEntry{value: 3, weight: 1, minRank: 1, maxRank: 2})
+	err = sum.Check(0)
+	if assert.Error(err) {
+		assert.Equal([]Violation{
+			{-1, "count 1 is smaller than the number of weighted entries 2"},
+		}, err.(*CheckError).Violations)
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Command quantiles computes approximate quantiles of the numbers read from
+files or stdin.
+
+Usage:
+
+	quantiles [flags] [file ...]
+	quantiles merge [flags] summary ...
+	quantiles inspect [flags] summary
+	quantiles diff [flags] summary summary
+
+Every non-empty line holds a value, or a value and a weight separated by
+the delimiter if -weighted is set. With -column the input is read as CSV
+and the value is taken from the given column. Lines starting with # are
+ignored. With -save the summary of the input is written to a file, in
+JSON if its name ends with .json and in the binary encoding otherwise.
+
+The merge, inspect and diff subcommands work on such serialized
+summaries: merge combines them into one, inspect prints the entries and
+statistics of a summary and diff compares the quantiles of two summaries.
+Run a subcommand with -h for its flags.
+
+Examples:
+
+	# p50, p90 and p99 of the response times in the 4th column of a log
+	quantiles -column 4 -delimiter ' ' access.log
+	# deciles as JSON
+	seq 1000 | quantiles -q 0.1,0.2,0.3,0.4,0.5,0.6,0.7,0.8,0.9 -format json
+	# compare the latencies of two days
+	quantiles -column 4 -delimiter ' ' -save mon.bin mon.log
+	quantiles -column 4 -delimiter ' ' -save tue.bin tue.log
+	quantiles diff mon.bin tue.bin
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/axiomhq/quantiles"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, "quantiles:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+// options configure how input is read into the sketch.
+type options struct {
+	eps         float64
+	maxElements int64
+	weighted    bool
+	column      int
+	delimiter   rune
+	header      bool
+}
+
+// quantileList is a flag holding a comma separated list of quantiles.
+type quantileList []float64
+
+func (l *quantileList) String() string {
+	s := make([]string, len(*l))
+	for i, q := range *l {
+		s[i] = strconv.FormatFloat(q, 'g', -1, 64)
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *quantileList) Set(value string) error {
+	var qs quantileList
+	for _, s := range strings.Split(value, ",") {
+		q, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return err
+		}
+		if !(q >= 0 && q <= 1) {
+			return fmt.Errorf("expected 0 <= q <= 1, got q = %v", q)
+		}
+		qs = append(qs, q)
+	}
+	*l = qs
+	return nil
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "merge":
+			return merge(args[1:], stdout)
+		case "inspect":
+			return inspect(args[1:], stdout)
+		case "diff":
+			return diff(args[1:], stdout)
+		}
+	}
+	return compute(args, stdin, stdout)
+}
+
+// compute summarizes the numbers of the input.
+func compute(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("quantiles", flag.ContinueOnError)
+	var opts options
+	qs := quantileList{0.5, 0.9, 0.99}
+	fs.Float64Var(&opts.eps, "eps", 0.001, "approximation error of the sketch")
+	fs.Int64Var(&opts.maxElements, "max-elements", 1e8, "maximum number of elements the error bound holds for")
+	fs.BoolVar(&opts.weighted, "weighted", false, "read value and weight pairs, with -column the weight is in the next column")
+	fs.IntVar(&opts.column, "column", 0, "read values from this CSV column, starting at 1")
+	delimiter := fs.String("delimiter", ",", "field delimiter of weighted and CSV input")
+	fs.BoolVar(&opts.header, "header", false, "skip the first line of every input")
+	fs.Var(&qs, "q", "comma separated quantiles to print")
+	numBoundaries := fs.Int64("boundaries", 0, "also print this many boundaries")
+	format := fs.String("format", "text", "output format, text or json")
+	save := fs.String("save", "", "write the summary to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if d := []rune(*delimiter); len(d) == 1 {
+		opts.delimiter = d[0]
+	} else {
+		return fmt.Errorf("delimiter should be a single character, got %q", *delimiter)
+	}
+	if opts.column < 0 {
+		return fmt.Errorf("column should be >= 1, got %v", opts.column)
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	sketch, err := quantiles.New(opts.eps, opts.maxElements)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		if err := read(sketch, "stdin", stdin, opts); err != nil {
+			return err
+		}
+	}
+	for _, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = read(sketch, name, f, opts)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := sketch.Finalize(); err != nil {
+		return err
+	}
+	sum, err := sketch.FinalSummary()
+	if err != nil {
+		return err
+	}
+	if *save != "" {
+		if err := saveSummary(*save, sum); err != nil {
+			return err
+		}
+	}
+
+	res, err := newResult(sum, qs, *numBoundaries)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	return res.writeText(stdout)
+}
+
+// read pushes the values of an input into the sketch.
+func read(sketch *quantiles.Sketch, name string, r io.Reader, opts options) error {
+	if opts.column > 0 {
+		return readCSV(sketch, name, r, opts)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || opts.header && line == 1 {
+			continue
+		}
+		value, weight := text, ""
+		if opts.weighted {
+			fields := strings.Split(text, string(opts.delimiter))
+			if len(fields) != 2 {
+				return fmt.Errorf("%v:%v: expected value%cweight, got %q", name, line, opts.delimiter, text)
+			}
+			value, weight = fields[0], fields[1]
+		}
+		if err := push(sketch, value, weight); err != nil {
+			return fmt.Errorf("%v:%v: %v", name, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// readCSV pushes the values of a CSV column into the sketch.
+func readCSV(sketch *quantiles.Sketch, name string, r io.Reader, opts options) error {
+	cr := csv.NewReader(r)
+	cr.Comma = opts.delimiter
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	if opts.delimiter == ' ' || opts.delimiter == '\t' {
+		cr.TrimLeadingSpace = true
+	}
+	for num := 1; ; num++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		if num == 1 && opts.header {
+			continue
+		}
+		if opts.column > len(record) {
+			return fmt.Errorf("%v: record %v: expected at least %v columns, got %v", name, num, opts.column, len(record))
+		}
+		weight := ""
+		if opts.weighted {
+			if opts.column == len(record) {
+				return fmt.Errorf("%v: record %v: no weight column after column %v", name, num, opts.column)
+			}
+			weight = record[opts.column]
+		}
+		if err := push(sketch, record[opts.column-1], weight); err != nil {
+			return fmt.Errorf("%v: record %v: %v", name, num, err)
+		}
+	}
+}
+
+// push parses a value and an optional weight and pushes them into the sketch.
+func push(sketch *quantiles.Sketch, value, weight string) error {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %q", value)
+	}
+	w := 1.0
+	if weight != "" {
+		if w, err = strconv.ParseFloat(strings.TrimSpace(weight), 64); err != nil {
+			return fmt.Errorf("invalid weight %q", weight)
+		}
+	}
+	return sketch.Push(v, w)
+}
+
+/*
+number is a float64 in the JSON output. Inputs may contain infinite
+values, which JSON numbers can't hold, so like the JSON encoding of
+summaries it writes them as the strings "+Inf" and "-Inf".
+*/
+type number float64
+
+func (n number) MarshalJSON() ([]byte, error) {
+	v := float64(n)
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return json.Marshal(strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return json.Marshal(v)
+}
+
+// quantileResult is the estimate of a single quantile.
+type quantileResult struct {
+	Q     float64 `json:"q"`
+	Value number  `json:"value"`
+	Lower number  `json:"lower"`
+	Upper number  `json:"upper"`
+}
+
+// result is the output of the command.
+type result struct {
+	Count              uint64           `json:"count"`
+	TotalWeight        number           `json:"totalWeight"`
+	Min                number           `json:"min"`
+	Max                number           `json:"max"`
+	ApproximationError number           `json:"approximationError"`
+	Quantiles          []quantileResult `json:"quantiles"`
+	Boundaries         []number         `json:"boundaries,omitempty"`
+}
+
+func newResult(sum *quantiles.Summary, qs []float64, numBoundaries int64) (*result, error) {
+	res := &result{
+		Count:              sum.Count(),
+		TotalWeight:        number(sum.TotalWeight()),
+		Min:                number(sum.MinValue()),
+		Max:                number(sum.MaxValue()),
+		ApproximationError: number(sum.ApproximationError()),
+		Quantiles:          make([]quantileResult, len(qs)),
+	}
+	for i, q := range qs {
+		value, lower, upper, err := sum.QuantileWithBounds(q)
+		if err != nil {
+			return nil, err
+		}
+		res.Quantiles[i] = quantileResult{q, number(value), number(lower), number(upper)}
+	}
+	if numBoundaries > 0 {
+		for _, b := range sum.GenerateBoundaries(numBoundaries) {
+			res.Boundaries = append(res.Boundaries, number(b))
+		}
+	}
+	return res, nil
+}
+
+func (res *result) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "count\t%v\n", res.Count)
+	fmt.Fprintf(tw, "total weight\t%v\n", res.TotalWeight)
+	fmt.Fprintf(tw, "min\t%v\n", res.Min)
+	fmt.Fprintf(tw, "max\t%v\n", res.Max)
+	fmt.Fprintf(tw, "approximation error\t%v\n", res.ApproximationError)
+	for _, q := range res.Quantiles {
+		fmt.Fprintf(tw, "q%v\t%v\t[%v, %v]\n", q.Q, q.Value, q.Lower, q.Upper)
+	}
+	if len(res.Boundaries) > 0 {
+		fmt.Fprintf(tw, "boundaries\t%v\n", strings.Trim(fmt.Sprint(res.Boundaries), "[]"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runString(args []string, stdin string) (string, error) {
+	var out bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &out)
+	return out.String(), err
+}
+
+func numbers(from, to int) string {
+	var b strings.Builder
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&b, "%v\n", i)
+	}
+	return b.String()
+}
+
+func TestRunText(t *testing.T) {
+	assert := assert.New(t)
+	out, err := runString([]string{"-q", "0.5,1", "-boundaries", "2"}, "# comment\n\n"+numbers(1, 100))
+	assert.NoError(err)
+	assert.Equal(`count                100
+total weight         100
+min                  1
+max                  100
+approximation error  0
+q0.5                 51   [50, 51]
+q1                   100  [100, 100]
+boundaries           1 51 100
+`, out)
+}
+
+func TestRunJSON(t *testing.T) {
+	assert := assert.New(t)
+	out, err := runString([]string{"-weighted", "-format", "json", "-q", "0.5"}, "1,1\n2,3\n")
+	assert.NoError(err)
+	var res result
+	assert.NoError(json.Unmarshal([]byte(out), &res))
+	assert.Equal(uint64(2), res.Count)
+	assert.Equal(number(4), res.TotalWeight)
+	assert.Equal([]quantileResult{{Q: 0.5, Value: 2, Lower: 2, Upper: 2}}, res.Quantiles)
+	assert.Nil(res.Boundaries)
+
+	// Infinite values are written as strings.
+	out, err = runString([]string{"-format", "json", "-q", "1", "-boundaries", "2"}, "1\n2\ninf\n-inf\n")
+	assert.NoError(err)
+	var raw struct {
+		Min        string
+		Max        string
+		Quantiles  []struct{ Value string }
+		Boundaries []interface{}
+	}
+	assert.NoError(json.Unmarshal([]byte(out), &raw))
+	assert.Equal("-Inf", raw.Min)
+	assert.Equal("+Inf", raw.Max)
+	assert.Equal("+Inf", raw.Quantiles[0].Value)
+	assert.Equal("-Inf", raw.Boundaries[0])
+}
+
+func TestRunCSVFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "quantiles")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.csv")
+	b := filepath.Join(dir, "b.csv")
+	assert.NoError(ioutil.WriteFile(a, []byte("name,latency,weight\nx,1,1\n\"y,z\",2,1\n"), 0644))
+	assert.NoError(ioutil.WriteFile(b, []byte("name,latency,weight\nx,3,2\n"), 0644))
+
+	out, err := runString([]string{"-column", "2", "-weighted", "-header", "-format", "json", a, b}, "")
+	assert.NoError(err)
+	var res result
+	assert.NoError(json.Unmarshal([]byte(out), &res))
+	assert.Equal(uint64(3), res.Count)
+	assert.Equal(number(4), res.TotalWeight)
+	assert.Equal(number(1), res.Min)
+	assert.Equal(number(3), res.Max)
+
+	out, err = runString([]string{"-column", "2", "-delimiter", " "}, "GET  12\nPOST 14\n")
+	assert.NoError(err)
+	assert.Contains(out, "min                  12\n")
+}
+
+func TestRunErrors(t *testing.T) {
+	assert := assert.New(t)
+	for _, args := range [][]string{
+		{"-q", "2"},
+		{"-format", "xml"},
+		{"-delimiter", "ab"},
+		{"-eps", "0"},
+		{"-column", "-1"},
+		{"does-not-exist"},
+	} {
+		_, err := runString(args, "1\n")
+		assert.Error(err, "%v", args)
+	}
+
+	_, err := runString(nil, "1\nabc\n")
+	assert.EqualError(err, `stdin:2: invalid value "abc"`)
+	_, err = runString([]string{"-weighted"}, "1\n")
+	assert.Error(err)
+	_, err = runString([]string{"-column", "3"}, "1,2\n")
+	assert.Error(err)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/axiomhq/quantiles"
+)
+
+// loadSummary reads a summary serialized in JSON or the binary encoding.
+func loadSummary(name string) (*quantiles.Summary, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	sum := &quantiles.Summary{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, sum)
+	} else {
+		err = sum.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	return sum, nil
+}
+
+// saveSummary writes a summary in JSON if name ends with .json and in the binary encoding otherwise.
+func saveSummary(name string, sum *quantiles.Summary) error {
+	data, err := marshalSummary(sum, strings.HasSuffix(name, ".json"))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+func marshalSummary(sum *quantiles.Summary, asJSON bool) ([]byte, error) {
+	if asJSON {
+		return json.Marshal(sum)
+	}
+	return sum.MarshalBinary()
+}
+
+// merge combines serialized summaries into one.
+func merge(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("quantiles merge", flag.ContinueOnError)
+	eps := fs.Float64("eps", 0.001, "compress the merged summary with this approximation error, 0 disables compression")
+	output := fs.String("o", "", "write the merged summary to this file instead of stdout")
+	asJSON := fs.Bool("json", false, "write the merged summary to stdout in JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("merge: no summaries given")
+	}
+
+	merged := &quantiles.Summary{}
+	for _, name := range fs.Args() {
+		sum, err := loadSummary(name)
+		if err != nil {
+			return err
+		}
+		merged.Merge(sum)
+	}
+	if *eps != 0 {
+		if err := merged.Compress(*eps); err != nil {
+			return err
+		}
+	}
+
+	if *output != "" {
+		return saveSummary(*output, merged)
+	}
+	data, err := marshalSummary(merged, *asJSON)
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(data)
+	return err
+}
+
+// inspectResult describes a summary and its entries.
+type inspectResult struct {
+	Count              uint64         `json:"count"`
+	TotalWeight        number         `json:"totalWeight"`
+	Min                number         `json:"min"`
+	Max                number         `json:"max"`
+	ApproximationError number         `json:"approximationError"`
+	Entries            []inspectEntry `json:"entries"`
+}
+
+type inspectEntry struct {
+	Value   number `json:"value"`
+	Weight  number `json:"weight"`
+	MinRank number `json:"minRank"`
+	MaxRank number `json:"maxRank"`
+}
+
+// inspect prints the statistics and entries of a summary.
+func inspect(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("quantiles inspect", flag.ContinueOnError)
+	format := fs.String("format", "text", "output format, text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("inspect: expected a single summary, got %v", fs.NArg())
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	sum, err := loadSummary(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	res := inspectResult{
+		Count:              sum.Count(),
+		TotalWeight:        number(sum.TotalWeight()),
+		Min:                number(sum.MinValue()),
+		Max:                number(sum.MaxValue()),
+		ApproximationError: number(sum.ApproximationError()),
+		Entries:            make([]inspectEntry, sum.Size()),
+	}
+	for i, e := range sum.Entries() {
+		res.Entries[i] = inspectEntry{number(e.Value()), number(e.Weight()), number(e.MinRank()), number(e.MaxRank())}
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "count\t%v\n", res.Count)
+	fmt.Fprintf(tw, "total weight\t%v\n", res.TotalWeight)
+	fmt.Fprintf(tw, "min\t%v\n", res.Min)
+	fmt.Fprintf(tw, "max\t%v\n", res.Max)
+	fmt.Fprintf(tw, "approximation error\t%v\n", res.ApproximationError)
+	fmt.Fprintf(tw, "entries\t%v\n", len(res.Entries))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout)
+	tw = tabwriter.NewWriter(stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "value\tweight\tminRank\tmaxRank\t\n")
+	for _, e := range res.Entries {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t\n", e.Value, e.Weight, e.MinRank, e.MaxRank)
+	}
+	return tw.Flush()
+}
+
+// diffQuantile compares a quantile of two summaries.
+type diffQuantile struct {
+	Q        float64 `json:"q"`
+	A        number  `json:"a"`
+	B        number  `json:"b"`
+	Delta    number  `json:"delta"`
+	Relative number  `json:"relative"`
+}
+
+type diffResult struct {
+	CountA    uint64         `json:"countA"`
+	CountB    uint64         `json:"countB"`
+	Quantiles []diffQuantile `json:"quantiles"`
+}
+
+// diff compares the quantiles of two summaries.
+func diff(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("quantiles diff", flag.ContinueOnError)
+	qs := quantileList{0, 0.5, 0.9, 0.99, 1}
+	fs.Var(&qs, "q", "comma separated quantiles to compare")
+	format := fs.String("format", "text", "output format, text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("diff: expected two summaries, got %v", fs.NArg())
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	a, err := loadSummary(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadSummary(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	res := diffResult{CountA: a.Count(), CountB: b.Count(), Quantiles: make([]diffQuantile, len(qs))}
+	for i, q := range qs {
+		va, _, _, err := a.QuantileWithBounds(q)
+		if err != nil {
+			return err
+		}
+		vb, _, _, err := b.QuantileWithBounds(q)
+		if err != nil {
+			return err
+		}
+		// There's no relative change from zero, report none rather than ±Inf.
+		relative := 0.0
+		if va != 0 {
+			relative = (vb - va) / math.Abs(va)
+		}
+		res.Quantiles[i] = diffQuantile{q, number(va), number(vb), number(vb - va), number(relative)}
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\t%v\t%v\t\t\t\n", fs.Arg(0), fs.Arg(1))
+	fmt.Fprintf(tw, "count\t%v\t%v\t\t\t\n", res.CountA, res.CountB)
+	for _, d := range res.Quantiles {
+		fmt.Fprintf(tw, "q%v\t%v\t%v\t%+g\t%+.2f%%\t\n", d.Q, d.A, d.B, d.Delta, 100*d.Relative)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/axiomhq/quantiles"
+	"github.com/stretchr/testify/assert"
+)
+
+// saveNumbers summarizes the numbers from..to into a file in dir.
+func saveNumbers(t *testing.T, dir, name string, from, to int) string {
+	path := filepath.Join(dir, name)
+	_, err := runString([]string{"-save", path}, numbers(from, to))
+	assert.NoError(t, err)
+	return path
+}
+
+func TestMerge(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "quantiles")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	a := saveNumbers(t, dir, "a.bin", 1, 1000)
+	b := saveNumbers(t, dir, "b.json", 1001, 3000)
+
+	merged := filepath.Join(dir, "merged.bin")
+	_, err = runString([]string{"merge", "-eps", "0.01", "-o", merged, a, b}, "")
+	assert.NoError(err)
+	sum, err := loadSummary(merged)
+	assert.NoError(err)
+	assert.Equal(uint64(3000), sum.Count())
+	assert.Equal(3000.0, sum.TotalWeight())
+	assert.Equal(1.0, sum.MinValue())
+	assert.Equal(3000.0, sum.MaxValue())
+	assert.True(sum.Size() <= 102)
+	assert.True(sum.ApproximationError() <= 0.01)
+
+	out, err := runString([]string{"merge", "-eps", "0", "-json", a, b}, "")
+	assert.NoError(err)
+	sum = &quantiles.Summary{}
+	assert.NoError(json.Unmarshal([]byte(out), sum))
+	assert.Equal(int64(3000), sum.Size())
+
+	_, err = runString([]string{"merge"}, "")
+	assert.Error(err)
+	_, err = runString([]string{"merge", filepath.Join(dir, "missing")}, "")
+	assert.Error(err)
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "garbage"), []byte("garbage"), 0644))
+	_, err = runString([]string{"merge", filepath.Join(dir, "garbage")}, "")
+	assert.Error(err)
+}
+
+func TestInspect(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "quantiles")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	a := saveNumbers(t, dir, "a.bin", 1, 3)
+
+	out, err := runString([]string{"inspect", a}, "")
+	assert.NoError(err)
+	assert.Equal(`count                3
+total weight         3
+min                  1
+max                  3
+approximation error  0
+entries              3
+
+  value  weight  minRank  maxRank
+      1       1        0        1
+      2       1        1        2
+      3       1        2        3
+`, out)
+
+	out, err = runString([]string{"inspect", "-format", "json", a}, "")
+	assert.NoError(err)
+	var res inspectResult
+	assert.NoError(json.Unmarshal([]byte(out), &res))
+	assert.Equal(uint64(3), res.Count)
+	assert.Equal(inspectEntry{Value: 2, Weight: 1, MinRank: 1, MaxRank: 2}, res.Entries[1])
+
+	// Infinite values are written as strings.
+	inf := filepath.Join(dir, "inf.json")
+	_, err = runString([]string{"-save", inf}, "1\n2\ninf\n")
+	assert.NoError(err)
+	out, err = runString([]string{"inspect", "-format", "json", inf}, "")
+	assert.NoError(err)
+	var raw struct {
+		Max     string
+		Entries []struct{ Value interface{} }
+	}
+	assert.NoError(json.Unmarshal([]byte(out), &raw))
+	assert.Equal("+Inf", raw.Max)
+	assert.Equal("+Inf", raw.Entries[2].Value)
+
+	_, err = runString([]string{"inspect", a, a}, "")
+	assert.Error(err)
+}
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "quantiles")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	a := saveNumbers(t, dir, "a.bin", 1, 100)
+	b := saveNumbers(t, dir, "b.bin", 101, 300)
+
+	out, err := runString([]string{"diff", "-q", "0,1", a, b}, "")
+	assert.NoError(err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(4, len(lines))
+	assert.Equal([]string{"count", "100", "200"}, strings.Fields(lines[1]))
+	assert.Equal([]string{"q0", "1", "101", "+100", "+10000.00%"}, strings.Fields(lines[2]))
+	assert.Equal([]string{"q1", "100", "300", "+200", "+200.00%"}, strings.Fields(lines[3]))
+
+	out, err = runString([]string{"diff", "-q", "0.5", "-format", "json", b, a}, "")
+	assert.NoError(err)
+	var res diffResult
+	assert.NoError(json.Unmarshal([]byte(out), &res))
+	assert.Equal(uint64(200), res.CountA)
+	assert.Equal([]diffQuantile{{Q: 0.5, A: 201, B: 51, Delta: -150, Relative: -150.0 / 201}}, res.Quantiles)
+
+	inf := filepath.Join(dir, "inf.bin")
+	_, err = runString([]string{"-save", inf}, "1\n2\ninf\n")
+	assert.NoError(err)
+	out, err = runString([]string{"diff", "-q", "1", "-format", "json", a, inf}, "")
+	assert.NoError(err)
+	var raw struct {
+		Quantiles []struct{ B, Delta, Relative string }
+	}
+	assert.NoError(json.Unmarshal([]byte(out), &raw))
+	assert.Equal("+Inf", raw.Quantiles[0].B)
+	assert.Equal("+Inf", raw.Quantiles[0].Delta)
+	assert.Equal("+Inf", raw.Quantiles[0].Relative)
+
+	_, err = runString([]string{"diff", a}, "")
+	assert.Error(err)
+}
@@ -0,0 +1,219 @@
+package quantiles
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+const compactEncodingVersion uint8 = 1
+
+// bitWriter appends individual bits, most significant first.
+type bitWriter struct {
+	buf   []byte
+	nbits uint // number of bits used in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.nbits == 0 || w.nbits == 8 {
+		w.buf = append(w.buf, 0)
+		w.nbits = 0
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << (7 - w.nbits)
+	}
+	w.nbits++
+}
+
+// writeBits writes the n least significant bits of v.
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for n > 0 {
+		n--
+		w.writeBit(v>>n&1 == 1)
+	}
+}
+
+// bitReader reads bits written by bitWriter. Reading past the end of the
+// data sets a sticky error.
+type bitReader struct {
+	buf  []byte
+	pos  uint
+	err  error
+	size uint
+}
+
+func newBitReader(buf []byte) *bitReader {
+	return &bitReader{buf: buf, size: uint(len(buf)) * 8}
+}
+
+func (r *bitReader) readBit() bool {
+	if r.err != nil {
+		return false
+	}
+	if r.pos >= r.size {
+		r.err = fmt.Errorf("unexpected end of compact data")
+		return false
+	}
+	bit := r.buf[r.pos/8]>>(7-r.pos%8)&1 == 1
+	r.pos++
+	return bit
+}
+
+func (r *bitReader) readBits(n uint) uint64 {
+	var v uint64
+	for ; n > 0; n-- {
+		v <<= 1
+		if r.readBit() {
+			v |= 1
+		}
+	}
+	return v
+}
+
+/*
+xorState holds the per-column state of the XOR float compression described
+in "Gorilla: A Fast, Scalable, In-Memory Time Series Database" (2015).
+Every value is XORed with a prediction; an exact prediction costs a single
+bit and a near miss only stores the meaningful bits of the XOR.
+*/
+type xorState struct {
+	leading  uint
+	trailing uint
+	valid    bool
+}
+
+func (s *xorState) write(w *bitWriter, v, pred float64) {
+	xor := math.Float64bits(v) ^ math.Float64bits(pred)
+	if xor == 0 {
+		w.writeBit(false)
+		return
+	}
+	w.writeBit(true)
+
+	leading := uint(bits.LeadingZeros64(xor))
+	trailing := uint(bits.TrailingZeros64(xor))
+	if leading > 31 {
+		leading = 31
+	}
+	if s.valid && leading >= s.leading && trailing >= s.trailing {
+		// Reuse the previous window.
+		w.writeBit(false)
+		w.writeBits(xor>>s.trailing, 64-s.leading-s.trailing)
+		return
+	}
+
+	sigBits := 64 - leading - trailing
+	w.writeBit(true)
+	w.writeBits(uint64(leading), 5)
+	w.writeBits(uint64(sigBits-1), 6)
+	w.writeBits(xor>>trailing, sigBits)
+	s.leading, s.trailing, s.valid = leading, trailing, true
+}
+
+func (s *xorState) read(r *bitReader, pred float64) float64 {
+	if !r.readBit() {
+		return pred
+	}
+	if r.readBit() {
+		leading := uint(r.readBits(5))
+		sigBits := uint(r.readBits(6)) + 1
+		if leading+sigBits > 64 {
+			if r.err == nil {
+				r.err = fmt.Errorf("invalid compact window: %v leading, %v significant bits", leading, sigBits)
+			}
+			return 0
+		}
+		s.leading, s.trailing, s.valid = leading, 64-leading-sigBits, true
+	} else if !s.valid {
+		if r.err == nil {
+			r.err = fmt.Errorf("compact data reuses a window before defining one")
+		}
+		return 0
+	}
+	xor := r.readBits(64-s.leading-s.trailing) << s.trailing
+	return math.Float64frombits(math.Float64bits(pred) ^ xor)
+}
+
+/*
+MarshalCompact returns a compact encoding of the summary intended for
+shipping finalized summaries over the wire.
+Values and weights are XOR-compressed against their predecessor, while
+ranks are XOR-compressed against the ranks implied by the cumulative
+weights, so uncompressed stretches of a summary cost a couple of bits
+per rank. The encoding is lossless: a summary restored with
+UnmarshalCompact yields identical quantiles.
+*/
+func (sum *Summary) MarshalCompact() ([]byte, error) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf := []byte{compactEncodingVersion}
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], sum.n)]...)
+	buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(sum.entries)))]...)
+
+	w := &bitWriter{buf: buf}
+	var (
+		values, weights, minRanks, maxRanks xorState
+		prev                                SumEntry
+	)
+	for _, entry := range sum.entries {
+		values.write(w, entry.value, prev.value)
+		weights.write(w, entry.weight, prev.weight)
+		minRanks.write(w, entry.minRank, prev.nextMinRank())
+		maxRanks.write(w, entry.maxRank, entry.nextMinRank())
+		prev = entry
+	}
+	return w.buf, nil
+}
+
+// UnmarshalCompact decodes a summary encoded by MarshalCompact.
+func (sum *Summary) UnmarshalCompact(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("unexpected end of compact data")
+	}
+	if data[0] != compactEncodingVersion {
+		return fmt.Errorf("unsupported compact encoding version: %v", data[0])
+	}
+	data = data[1:]
+	n, k := binary.Uvarint(data)
+	if k <= 0 {
+		return fmt.Errorf("invalid compact header")
+	}
+	data = data[k:]
+	size, k := binary.Uvarint(data)
+	if k <= 0 {
+		return fmt.Errorf("invalid compact header")
+	}
+	data = data[k:]
+	// Every entry takes at least four bits.
+	if size > uint64(len(data))*2 {
+		return fmt.Errorf("invalid compact entry count %v for %v bytes", size, len(data))
+	}
+
+	r := newBitReader(data)
+	entries := make([]SumEntry, size)
+	var (
+		values, weights, minRanks, maxRanks xorState
+		prev                                SumEntry
+	)
+	for i := range entries {
+		entry := SumEntry{}
+		entry.value = values.read(r, prev.value)
+		entry.weight = weights.read(r, prev.weight)
+		entry.minRank = minRanks.read(r, prev.nextMinRank())
+		entry.maxRank = maxRanks.read(r, entry.nextMinRank())
+		entries[i] = entry
+		prev = entry
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if uint(len(data)) != (r.pos+7)/8 {
+		return fmt.Errorf("%v trailing bytes after decoding", uint(len(data))-(r.pos+7)/8)
+	}
+
+	*sum = Summary{
+		entries: entries,
+		n:       n,
+	}
+	return nil
+}
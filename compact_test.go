@@ -0,0 +1,98 @@
+package quantiles
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitStream(t *testing.T) {
+	assert := assert.New(t)
+	w := &bitWriter{}
+	w.writeBit(true)
+	w.writeBits(0x5, 3)
+	w.writeBits(0xabcdef, 24)
+	w.writeBit(false)
+	w.writeBits(math.MaxUint64, 64)
+
+	r := newBitReader(w.buf)
+	assert.True(r.readBit())
+	assert.Equal(uint64(0x5), r.readBits(3))
+	assert.Equal(uint64(0xabcdef), r.readBits(24))
+	assert.False(r.readBit())
+	assert.Equal(uint64(math.MaxUint64), r.readBits(64))
+	assert.NoError(r.err)
+	r.readBits(8)
+	assert.Error(r.err)
+}
+
+func TestSummaryCompactRoundTrip(t *testing.T) {
+	for _, gen := range []workerSummaryGeneratorFunc{
+		generateFixedUniformSummary,
+		generateFixedNonUniformSummary,
+		generateRandUniformRandWeightsSummary,
+	} {
+		assert := assert.New(t)
+		stream, err := New(0.01, 1<<16)
+		assert.NoError(err)
+		totalWeight := 0.0
+		assert.NoError(gen(0, 1<<16, &totalWeight, stream))
+		sum, err := stream.FinalSummary()
+		assert.NoError(err)
+
+		data, err := sum.MarshalCompact()
+		assert.NoError(err)
+		raw, err := sum.MarshalBinary()
+		assert.NoError(err)
+		assert.True(len(data) < len(raw), "compact %v >= raw %v", len(data), len(raw))
+
+		got := &Summary{}
+		assert.NoError(got.UnmarshalCompact(data))
+		assert.Equal(sum.entries, got.entries)
+		assert.Equal(sum.n, got.n)
+		assert.Equal(sum.GenerateQuantiles(100), got.GenerateQuantiles(100))
+	}
+}
+
+func TestSummaryCompactSpecialValues(t *testing.T) {
+	assert := assert.New(t)
+	sum := &Summary{}
+	sum.buildFromBufferEntries([]bufEntry{
+		{math.Inf(-1), 1}, {-0.5, 2}, {0, 0.25}, {1e-300, 3}, {math.MaxFloat64, 1}, {math.Inf(1), 7},
+	})
+	data, err := sum.MarshalCompact()
+	assert.NoError(err)
+	got := &Summary{}
+	assert.NoError(got.UnmarshalCompact(data))
+	assert.Equal(sum.entries, got.entries)
+
+	empty := &Summary{}
+	data, err = empty.MarshalCompact()
+	assert.NoError(err)
+	assert.NoError(got.UnmarshalCompact(data))
+	assert.Equal(int64(0), got.Size())
+}
+
+func TestSummaryCompactInvalid(t *testing.T) {
+	assert := assert.New(t)
+	sum := &Summary{}
+	entries := make([]bufEntry, 100)
+	for i := range entries {
+		entries[i] = bufEntry{float64(i) + rand.Float64(), rand.Float64()}
+	}
+	sum.buildFromBufferEntries(entries)
+	data, err := sum.MarshalCompact()
+	assert.NoError(err)
+
+	got := &Summary{}
+	assert.Error(got.UnmarshalCompact(nil))
+	assert.Error(got.UnmarshalCompact(data[:len(data)/2]))
+	assert.Error(got.UnmarshalCompact(append(data, 0, 0)))
+	assert.Error(got.UnmarshalCompact([]byte{compactEncodingVersion, 0, 0xff, 0xff, 0xff, 0xff, 0x0f}))
+
+	bad := append([]byte{}, data...)
+	bad[0]++
+	assert.Error(got.UnmarshalCompact(bad))
+}
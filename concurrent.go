@@ -0,0 +1,212 @@
+package quantiles
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// concurrentShard buffers pushed elements before they are flushed into the sketch.
+type concurrentShard struct {
+	mu  sync.Mutex
+	buf []bufEntry
+}
+
+/*
+ConcurrentSketch is a Sketch that is safe for concurrent use by multiple
+goroutines. Pushed elements are spread over per-CPU shards and only
+flushed into the shared level hierarchy once a shard holds a full block,
+so goroutines pushing simultaneously rarely contend on the same lock.
+*/
+type ConcurrentSketch struct {
+	// invalid counts the invalid inputs handled by Push. It is updated
+	// atomically and comes first to keep it 64-bit aligned.
+	invalid InvalidInputs
+
+	// Policy must not change once pushing started. Inputs are checked
+	// before they are buffered, so rejected ones fail their own Push
+	// rather than a later flush.
+	Policy InputPolicy
+
+	// state is held for reading by Push and for writing by Finalize, so
+	// Finalize can't miss elements that are being flushed.
+	state     sync.RWMutex
+	finalized bool
+
+	mu     sync.Mutex // guards sketch
+	sketch *Sketch
+
+	shards    []*concurrentShard
+	shardSize int
+	next      uint32
+}
+
+// NewConcurrent returns a new ConcurrentSketch for a given eps and maxElements
+func NewConcurrent(eps float64, maxElements int64) (*ConcurrentSketch, error) {
+	sketch, err := New(eps, maxElements)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &ConcurrentSketch{
+		Policy:    defaultInputPolicy,
+		sketch:    sketch,
+		shards:    make([]*concurrentShard, runtime.GOMAXPROCS(0)),
+		shardSize: int(sketch.buffer.maxSize),
+	}
+	for i := range cs.shards {
+		cs.shards[i] = &concurrentShard{
+			buf: make([]bufEntry, 0, cs.shardSize),
+		}
+	}
+	return cs, nil
+}
+
+// Push a value and a weight into the stream
+func (cs *ConcurrentSketch) Push(value float64, weight float64) error {
+	cs.state.RLock()
+	defer cs.state.RUnlock()
+	if cs.finalized {
+		return ErrFinalized
+	}
+
+	pushed, pushedWeight, action := cs.Policy.Apply(value, weight)
+	switch action {
+	case RejectInput:
+		atomic.AddUint64(&cs.invalid.Rejected, 1)
+		return invalidInputError(value, weight)
+	case DropInput:
+		atomic.AddUint64(&cs.invalid.Dropped, 1)
+		return nil
+	case ClampInput:
+		atomic.AddUint64(&cs.invalid.Clamped, 1)
+	}
+	value, weight = pushed, pushedWeight
+
+	shard := cs.shards[atomic.AddUint32(&cs.next, 1)%uint32(len(cs.shards))]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.buf = append(shard.buf, bufEntry{value, weight})
+	if len(shard.buf) < cs.shardSize {
+		return nil
+	}
+	// The shard stays locked until its block is flushed, so a concurrent
+	// Snapshot finds the block either in the shard or in the sketch.
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	err := cs.flush(shard.buf)
+	shard.buf = shard.buf[:0]
+	return err
+}
+
+/*
+flush pushes entries into the sketch, cs.mu must be held. Every entry is
+pushed even if some fail, the first error is returned along with the
+number of further failures.
+*/
+func (cs *ConcurrentSketch) flush(entries []bufEntry) error {
+	// Buffered entries already passed the policy, so the sketch accepts them
+	// as is but counts zero weights.
+	cs.sketch.Policy = cs.Policy
+	var first error
+	failed := 0
+	for _, entry := range entries {
+		if err := cs.sketch.Push(entry.value, entry.weight); err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	if failed > 1 {
+		return fmt.Errorf("%w (and %v more failed entries)", first, failed-1)
+	}
+	return first
+}
+
+/*
+Snapshot returns the summary of all elements pushed so far without
+finalizing the stream, see Sketch.Snapshot.
+Writers are only blocked while the shards and the level hierarchy are
+copied. Every Push that returned before the snapshot is included,
+concurrent ones may be missed.
+*/
+func (cs *ConcurrentSketch) Snapshot() *Summary {
+	// Finalize empties the shards before flushing them, don't look in between.
+	cs.state.RLock()
+	defer cs.state.RUnlock()
+
+	// Shards are locked before cs.mu, as in Push, and all of them are held
+	// while copying, so no element is missed or counted twice.
+	for _, shard := range cs.shards {
+		shard.mu.Lock()
+	}
+	var entries []bufEntry
+	for _, shard := range cs.shards {
+		entries = append(entries, shard.buf...)
+	}
+	cs.mu.Lock()
+	snapshot := cs.sketch.clone()
+	cs.mu.Unlock()
+	for _, shard := range cs.shards {
+		shard.mu.Unlock()
+	}
+	snapshot.Policy = cs.Policy
+
+	if !snapshot.finalized {
+		for _, entry := range entries {
+			snapshot.Push(entry.value, entry.weight)
+		}
+		snapshot.Finalize()
+	}
+	return snapshot.localSummary
+}
+
+// Finalize waits for pending pushes, flushes all shards and finalizes state.
+func (cs *ConcurrentSketch) Finalize() error {
+	cs.state.Lock()
+	defer cs.state.Unlock()
+	if cs.finalized {
+		return ErrFinalized
+	}
+	cs.finalized = true
+
+	var entries []bufEntry
+	for _, shard := range cs.shards {
+		shard.mu.Lock()
+		entries = append(entries, shard.buf...)
+		shard.buf = nil
+		shard.mu.Unlock()
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := cs.flush(entries); err != nil {
+		return err
+	}
+	return cs.sketch.Finalize()
+}
+
+/*
+InvalidInputs returns the counts of invalid inputs pushed so far. Zero
+weights are only counted once their shard is flushed.
+*/
+func (cs *ConcurrentSketch) InvalidInputs() InvalidInputs {
+	invalid := InvalidInputs{
+		Rejected: atomic.LoadUint64(&cs.invalid.Rejected),
+		Dropped:  atomic.LoadUint64(&cs.invalid.Dropped),
+		Clamped:  atomic.LoadUint64(&cs.invalid.Clamped),
+	}
+	cs.mu.Lock()
+	invalid.add(cs.sketch.InvalidInputs())
+	cs.mu.Unlock()
+	return invalid
+}
+
+// FinalSummary ...
+func (cs *ConcurrentSketch) FinalSummary() (*Summary, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.sketch.FinalSummary()
+}
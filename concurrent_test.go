@@ -0,0 +1,166 @@
+package quantiles
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentSketch(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		eps         = 0.01
+		numWorkers  = 8
+		perWorker   = 1 << 14
+		maxElements = int64(numWorkers * perWorker)
+	)
+	cs, err := NewConcurrent(eps, maxElements)
+	assert.NoError(err)
+
+	var (
+		wg     sync.WaitGroup
+		pushed int64
+	)
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < int(maxElements); i += numWorkers {
+				if err := cs.Push(float64(i)/float64(maxElements), 1); err != nil {
+					t.Error(err)
+					return
+				}
+				atomic.AddInt64(&pushed, 1)
+			}
+		}(w)
+	}
+
+	// Snapshots taken while pushing see every completed push and never
+	// more than what was pushed.
+	for i := 0; i < 10; i++ {
+		before := atomic.LoadInt64(&pushed)
+		snapshot := cs.Snapshot()
+		assert.True(snapshot.TotalWeight() >= float64(before), "%v < %v", snapshot.TotalWeight(), before)
+		assert.True(snapshot.TotalWeight() <= float64(maxElements))
+	}
+	wg.Wait()
+
+	snapshot := cs.Snapshot()
+	assert.Equal(float64(maxElements), snapshot.TotalWeight())
+
+	assert.NoError(cs.Finalize())
+	assert.Equal(ErrFinalized, cs.Push(1, 1))
+	assert.Equal(ErrFinalized, cs.Finalize())
+
+	sum, err := cs.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(float64(maxElements), sum.TotalWeight())
+	assert.Equal(uint64(maxElements), sum.n)
+	assert.True(sum.ApproximationError() <= eps)
+	for i, actual := range sum.GenerateQuantiles(10) {
+		assert.InDelta(float64(i)/10, actual, 1e-2)
+	}
+	assert.Equal(sum.entries, cs.Snapshot().entries)
+}
+
+func TestConcurrentSketchFinalizeFlushesShards(t *testing.T) {
+	assert := assert.New(t)
+	cs, err := NewConcurrent(0.01, 1000)
+	assert.NoError(err)
+	_, err = cs.FinalSummary()
+	assert.Error(err)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(cs.Push(rand.Float64(), 2))
+	}
+	assert.Equal(20.0, cs.Snapshot().TotalWeight())
+	assert.NoError(cs.Finalize())
+	sum, err := cs.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(20.0, sum.TotalWeight())
+}
+
+func TestConcurrentSketchFlushPushesAllEntries(t *testing.T) {
+	assert := assert.New(t)
+	cs, err := NewConcurrent(0.01, 1000)
+	assert.NoError(err)
+	cs.Policy.NaNValues = RejectInput
+
+	err = cs.flush([]bufEntry{{math.NaN(), 1}, {1, 1}, {math.NaN(), 1}, {2, 1}, {math.NaN(), 1}})
+	assert.True(errors.Is(err, ErrInvalidInput))
+	assert.Contains(err.Error(), "2 more")
+	assert.Equal(uint64(2), cs.sketch.n)
+}
+
+func TestConcurrentSketchSnapshotDuringFinalize(t *testing.T) {
+	assert := assert.New(t)
+	cs, err := NewConcurrent(0.01, 1000)
+	assert.NoError(err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(cs.Push(float64(i), 1))
+	}
+
+	started, stop, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		cs.Snapshot()
+		close(started)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				// Shards emptied by Finalize but not yet flushed aren't visible.
+				if weight := cs.Snapshot().TotalWeight(); weight != 100 {
+					t.Errorf("snapshot during Finalize has total weight %v", weight)
+					return
+				}
+			}
+		}
+	}()
+	<-started
+	assert.NoError(cs.Finalize())
+	close(stop)
+	<-done
+	assert.Equal(100.0, cs.Snapshot().TotalWeight())
+}
+
+func BenchmarkConcurrentPush(b *testing.B) {
+	cs, err := NewConcurrent(0.01, 1<<20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		x := rand.Float64()
+		for pb.Next() {
+			if err := cs.Push(x, 1); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func TestConcurrentSketchPolicy(t *testing.T) {
+	assert := assert.New(t)
+	cs, err := NewConcurrent(0.01, 1000)
+	assert.NoError(err)
+	assert.NoError(cs.Push(math.NaN(), 1))
+	assert.NoError(cs.Push(1, 0))
+
+	// Rejected inputs fail their own push instead of a later flush.
+	cs.Policy = InputPolicy{NaNValues: RejectInput, InfValues: ClampInput, Weights: DropInput}
+	assert.True(errors.Is(cs.Push(math.NaN(), 1), ErrInvalidInput))
+	assert.NoError(cs.Push(math.Inf(1), 1))
+	assert.NoError(cs.Push(1, -1))
+	assert.Equal(InvalidInputs{Rejected: 1, Dropped: 2, Clamped: 1}, cs.InvalidInputs())
+
+	assert.Equal(math.MaxFloat64, cs.Snapshot().MaxValue())
+	assert.NoError(cs.Finalize())
+	assert.Equal(InvalidInputs{Rejected: 1, Dropped: 2, Clamped: 1, ZeroWeights: 1}, cs.InvalidInputs())
+}
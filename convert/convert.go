@@ -0,0 +1,158 @@
+/*
+Package convert imports the state of other streaming quantile
+estimators into quantiles.Summary, so archived data can be merged with new
+sketches, e.g. via Sketch.PushSummary(summary.Entries()).
+
+Neither t-digests nor perks streams guarantee rank bounds the way the
+summaries of this package do, so the conversions are conservative: every
+entry's rank interval covers all ranks the source data structure admits,
+and the resulting ApproximationError reflects that.
+*/
+package convert
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/axiomhq/quantiles"
+	"github.com/beorn7/perks/quantile"
+	"github.com/stripe/veneur/tdigest"
+)
+
+// rankedEntry is a summary entry under construction.
+type rankedEntry struct {
+	value, weight, minRank, maxRank float64
+}
+
+/*
+summaryFromRanked widens the rank bounds of entries sorted by value until
+they are monotone and builds a summary from them. Raising a lower bound to
+the previous entry's lower bound plus its weight, or an upper bound to the
+previous upper bound plus the entry's weight, keeps the bounds valid.
+*/
+func summaryFromRanked(ranked []rankedEntry) (*quantiles.Summary, error) {
+	entries := make([]quantiles.SumEntry, len(ranked))
+	for i := range ranked {
+		e := &ranked[i]
+		if i > 0 {
+			prev := ranked[i-1]
+			e.minRank = math.Max(e.minRank, prev.minRank+prev.weight)
+			e.maxRank = math.Max(e.maxRank, prev.maxRank+e.weight)
+		}
+		e.maxRank = math.Max(e.maxRank, e.minRank+e.weight)
+
+		entry, err := quantiles.NewSumEntry(e.value, e.weight, e.minRank, e.maxRank)
+		if err != nil {
+			return nil, fmt.Errorf("entry %v: %v", i, err)
+		}
+		entries[i] = entry
+	}
+	return quantiles.NewSummaryFromEntries(entries)
+}
+
+/*
+FromMergingDigest converts a veneur t-digest into a summary, see
+FromCentroids.
+*/
+func FromMergingDigest(td *tdigest.MergingDigest) (*quantiles.Summary, error) {
+	data := td.Data()
+	return FromCentroids(data.MainCentroids, data.Min, data.Max)
+}
+
+/*
+FromCentroids converts the centroids of a t-digest along with its
+minimum and maximum into a summary.
+Assuming centroids don't overlap, the weight of the elements less than
+or equal to the mean of a centroid lies between the weight of all
+previous centroids and that plus the centroid's own weight. As the mean
+itself need not be an element, the entries carry no weight of their own.
+*/
+func FromCentroids(centroids []tdigest.Centroid, min, max float64) (*quantiles.Summary, error) {
+	sorted := make([]tdigest.Centroid, 0, len(centroids))
+	for _, c := range centroids {
+		if c.Mean != c.Mean || !(c.Weight >= 0) {
+			return nil, fmt.Errorf("invalid centroid (mean %v, weight %v)", c.Mean, c.Weight)
+		}
+		if c.Weight > 0 {
+			sorted = append(sorted, c)
+		}
+	}
+	if len(sorted) == 0 {
+		return quantiles.NewSummaryFromEntries(nil)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Mean < sorted[j].Mean })
+	if !(min <= sorted[0].Mean) || !(max >= sorted[len(sorted)-1].Mean) {
+		return nil, fmt.Errorf("min %v and max %v don't enclose the centroids", min, max)
+	}
+
+	ranked := make([]rankedEntry, 0, len(sorted)+2)
+	ranked = append(ranked, rankedEntry{value: min, maxRank: sorted[0].Weight})
+	var cumWeight float64
+	for _, c := range sorted {
+		ranked = append(ranked, rankedEntry{
+			value:   c.Mean,
+			minRank: cumWeight,
+			maxRank: cumWeight + c.Weight,
+		})
+		cumWeight += c.Weight
+	}
+	last := sorted[len(sorted)-1]
+	ranked = append(ranked, rankedEntry{value: max, minRank: cumWeight - last.Weight, maxRank: cumWeight})
+	return summaryFromRanked(ranked)
+}
+
+// FromStream converts a perks stream into a summary, see FromSamples.
+func FromStream(s *quantile.Stream) (*quantiles.Summary, error) {
+	return FromSamples(s.Samples())
+}
+
+/*
+FromSamples converts the samples of a perks stream into a summary.
+Following the CKMS algorithm, the weight of the elements less than or
+equal to a sample lies between the sum of the widths of the samples up to
+it and that plus its delta. Every sample is an observed element, so it
+carries the weight of a single element.
+*/
+func FromSamples(samples quantile.Samples) (*quantiles.Summary, error) {
+	sorted := make(quantile.Samples, 0, len(samples))
+	for _, s := range samples {
+		if s.Value != s.Value || !(s.Width >= 0) {
+			return nil, fmt.Errorf("invalid sample (value %v, width %v)", s.Value, s.Width)
+		}
+		if s.Width > 0 {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.Stable(sorted)
+
+	var ranked []rankedEntry
+	var cumWidth float64
+	for _, s := range sorted {
+		cumWidth += s.Width
+		weight := math.Min(1, s.Width)
+		maxRank := cumWidth + math.Max(0, s.Delta)
+		if n := len(ranked); n > 0 && ranked[n-1].value == s.Value {
+			// Samples of equal values share their rank bounds.
+			ranked[n-1].weight += weight
+			ranked[n-1].minRank = math.Min(ranked[n-1].minRank, cumWidth-ranked[n-1].weight)
+			ranked[n-1].maxRank = maxRank
+			continue
+		}
+		ranked = append(ranked, rankedEntry{
+			value:   s.Value,
+			weight:  weight,
+			minRank: cumWidth - weight,
+			maxRank: maxRank,
+		})
+	}
+
+	// Upper bounds can't exceed the total weight minus the weight of the
+	// larger samples.
+	larger := 0.0
+	for i := len(ranked) - 1; i >= 0; i-- {
+		ranked[i].maxRank = math.Min(ranked[i].maxRank, cumWidth-larger)
+		larger += ranked[i].weight
+	}
+	return summaryFromRanked(ranked)
+}
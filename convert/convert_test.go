@@ -0,0 +1,142 @@
+package convert
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/axiomhq/quantiles"
+	"github.com/beorn7/perks/quantile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stripe/veneur/tdigest"
+)
+
+const numValues = 10000
+
+// shuffled returns the values 1..numValues in random order.
+func shuffled() []float64 {
+	values := make([]float64, numValues)
+	for i, j := range rand.New(rand.NewSource(1)).Perm(numValues) {
+		values[i] = float64(j + 1)
+	}
+	return values
+}
+
+// assertConservative checks that the exact ranks of 1..numValues lie within the summary's rank bounds.
+func assertConservative(t *testing.T, sum *quantiles.Summary) {
+	assert.Equal(t, float64(numValues), sum.TotalWeight())
+	assert.Equal(t, uint64(numValues), sum.Count())
+	for v := 0.5; v <= numValues+1; v += 7 {
+		exact := float64(int(v))
+		if exact > numValues {
+			exact = numValues
+		}
+		_, lower, upper := sum.Rank(v)
+		assert.True(t, lower <= exact && exact <= upper, "rank of %v: %v not in [%v, %v]", v, exact, lower, upper)
+	}
+}
+
+func TestFromMergingDigest(t *testing.T) {
+	td := tdigest.NewMerging(100, false)
+	for _, v := range shuffled() {
+		td.Add(v, 1)
+	}
+
+	sum, err := FromMergingDigest(td)
+	assert.NoError(t, err)
+	assert.NoError(t, sum.Check(0))
+	assertConservative(t, sum)
+	assert.Equal(t, 1.0, sum.MinValue())
+	assert.Equal(t, float64(numValues), sum.MaxValue())
+	assert.True(t, sum.ApproximationError() < 0.05)
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		exact := float64(int(q*(numValues-1)) + 1)
+		_, lower, upper, err := sum.QuantileWithBounds(q)
+		assert.NoError(t, err)
+		assert.True(t, lower <= exact && exact <= upper, "q = %v: %v not in [%v, %v]", q, exact, lower, upper)
+	}
+}
+
+func TestFromCentroids(t *testing.T) {
+	assert := assert.New(t)
+	sum, err := FromCentroids([]tdigest.Centroid{{Mean: 5, Weight: 2}, {Mean: 2, Weight: 1}, {Mean: 9, Weight: 0}}, 2, 6)
+	assert.NoError(err)
+	assert.Equal([]float64{2, 2, 5, 6}, values(sum))
+	assert.Equal(3.0, sum.TotalWeight())
+	_, lower, upper := sum.Rank(5)
+	assert.Equal([]float64{1, 3}, []float64{lower, upper})
+
+	sum, err = FromCentroids(nil, 0, 0)
+	assert.NoError(err)
+	assert.Equal(int64(0), sum.Size())
+
+	_, err = FromCentroids([]tdigest.Centroid{{Mean: 5, Weight: 1}}, 6, 7)
+	assert.Error(err)
+	_, err = FromCentroids([]tdigest.Centroid{{Mean: 5, Weight: -1}}, 5, 5)
+	assert.Error(err)
+}
+
+func TestFromStream(t *testing.T) {
+	for _, s := range []*quantile.Stream{
+		quantile.NewLowBiased(0.01),
+		quantile.NewHighBiased(0.01),
+		quantile.NewTargeted(map[float64]float64{0.5: 0.05, 0.99: 0.001}),
+	} {
+		for _, v := range shuffled() {
+			s.Insert(v)
+		}
+		sum, err := FromStream(s)
+		assert.NoError(t, err)
+		assertConservative(t, sum)
+	}
+}
+
+func TestFromSamples(t *testing.T) {
+	assert := assert.New(t)
+	sum, err := FromSamples(quantile.Samples{
+		{Value: 3, Width: 2, Delta: 1},
+		{Value: 1, Width: 1},
+		{Value: 3, Width: 1},
+		{Value: 4, Width: 1, Delta: 5},
+	})
+	assert.NoError(err)
+	assert.Equal([]float64{1, 3, 4}, values(sum))
+	assert.Equal(5.0, sum.TotalWeight())
+	_, lower, upper := sum.Rank(3)
+	assert.Equal([]float64{4, 4}, []float64{lower, upper})
+
+	_, err = FromSamples(quantile.Samples{{Value: 1, Width: -1}})
+	assert.Error(err)
+}
+
+func TestMergeIntoSketch(t *testing.T) {
+	td := tdigest.NewMerging(100, false)
+	s := quantile.NewLowBiased(0.01)
+	for i, v := range shuffled() {
+		if i%2 == 0 {
+			td.Add(v, 1)
+		} else {
+			s.Insert(v)
+		}
+	}
+	fromDigest, err := FromMergingDigest(td)
+	assert.NoError(t, err)
+	fromStream, err := FromStream(s)
+	assert.NoError(t, err)
+
+	sketch, err := quantiles.New(0.01, 2*numValues)
+	assert.NoError(t, err)
+	assert.NoError(t, sketch.PushSummary(fromDigest.Entries()))
+	assert.NoError(t, sketch.PushSummary(fromStream.Entries()))
+	assert.NoError(t, sketch.Finalize())
+	median, _, _, err := sketch.QuantileWithBounds(0.5)
+	assert.NoError(t, err)
+	assert.InDelta(t, numValues/2, median, 0.05*numValues)
+}
+
+func values(sum *quantiles.Summary) []float64 {
+	var values []float64
+	for _, e := range sum.Entries() {
+		values = append(values, e.Value())
+	}
+	return values
+}
@@ -0,0 +1,112 @@
+package quantiles
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// decayRenormalizeExponent bounds the exponent of the forward decay factor
+// before all weights are renormalized, keeping them far from overflowing.
+const decayRenormalizeExponent = 64
+
+/*
+DecayedSketch is a Sketch whose elements are weighted by their age using
+forward decay, as described in "Forward Decay: A Practical Time Decay
+Model for Streaming Systems" (2009).
+An element pushed at time t with weight w contributes
+w * exp(lambda * (t - t0)) for a landmark time t0, so relative to the
+present older elements count exponentially less. Whenever the factor
+grows too large the landmark is moved forward and the weights and ranks
+of all summaries are renormalized. Quantile queries are unaffected by
+the landmark as they only depend on relative weights.
+A DecayedSketch needs external locking when shared between goroutines.
+*/
+type DecayedSketch struct {
+	// Now timestamps the elements pushed by Push, defaults to time.Now.
+	Now func() time.Time
+	// Policy is handed to the underlying sketch on every push. Decaying
+	// scales weights by a positive factor, so it doesn't change which
+	// inputs are invalid.
+	Policy InputPolicy
+
+	lambda   float64
+	landmark time.Time
+	sketch   *Sketch
+}
+
+/*
+NewDecayed returns a new DecayedSketch for a given eps and maxElements
+with a decay rate of lambda per second, i.e. the weight of an element
+halves every ln(2) / lambda seconds.
+*/
+func NewDecayed(eps float64, maxElements int64, lambda float64) (*DecayedSketch, error) {
+	if !(lambda >= 0) || math.IsInf(lambda, 1) {
+		return nil, fmt.Errorf("%w: lambda should be a finite value >= 0, got %v", ErrInvalidArgument, lambda)
+	}
+	sketch, err := New(eps, maxElements)
+	if err != nil {
+		return nil, err
+	}
+	return &DecayedSketch{
+		Now:    time.Now,
+		Policy: defaultInputPolicy,
+		lambda: lambda,
+		sketch: sketch,
+	}, nil
+}
+
+// Push a value and a weight into the stream at the current time
+func (ds *DecayedSketch) Push(value float64, weight float64) error {
+	return ds.PushAt(ds.Now(), value, weight)
+}
+
+// PushAt pushes a value and a weight into the stream at time t
+func (ds *DecayedSketch) PushAt(t time.Time, value float64, weight float64) error {
+	if ds.landmark.IsZero() {
+		ds.landmark = t
+	}
+	exponent := ds.lambda * t.Sub(ds.landmark).Seconds()
+	if exponent > decayRenormalizeExponent {
+		ds.renormalize(t)
+		exponent = 0
+	}
+	ds.sketch.Policy = ds.Policy
+	return ds.sketch.Push(value, weight*math.Exp(exponent))
+}
+
+// InvalidInputs returns the counts of invalid inputs pushed so far.
+func (ds *DecayedSketch) InvalidInputs() InvalidInputs {
+	return ds.sketch.InvalidInputs()
+}
+
+// renormalize moves the landmark to t and rescales all weights accordingly.
+func (ds *DecayedSketch) renormalize(t time.Time) {
+	ds.sketch.scale(math.Exp(-ds.lambda * t.Sub(ds.landmark).Seconds()))
+	ds.landmark = t
+}
+
+/*
+Snapshot returns the summary of the decayed stream, see Sketch.Snapshot.
+Weights and ranks are relative to the current landmark.
+*/
+func (ds *DecayedSketch) Snapshot() *Summary {
+	return ds.sketch.Snapshot()
+}
+
+/*
+Quantile returns the value for quantile q of the decayed stream. It takes
+a snapshot on every call, whose cost depends on the size of the sketch's
+summaries, not on the number of pushed elements.
+*/
+func (ds *DecayedSketch) Quantile(q float64) (float64, error) {
+	return ds.Snapshot().Quantile(q)
+}
+
+/*
+GenerateQuantiles generates the requested number of quantiles of the
+decayed stream, see Summary.GenerateQuantiles.
+*/
+func (ds *DecayedSketch) GenerateQuantiles(numQuantiles int64) []float64 {
+	return ds.Snapshot().GenerateQuantiles(numQuantiles)
+}
@@ -0,0 +1,123 @@
+package quantiles
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayedSketchInvalid(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewDecayed(0.01, 1000, -1)
+	assert.Error(err)
+	_, err = NewDecayed(0.01, 1000, math.NaN())
+	assert.Error(err)
+	_, err = NewDecayed(0.01, 1000, math.Inf(1))
+	assert.Error(err)
+	_, err = NewDecayed(0, 1000, 1)
+	assert.Error(err)
+}
+
+func TestDecayedSketchWeights(t *testing.T) {
+	assert := assert.New(t)
+	clock := &fakeClock{now: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	// Weights double every minute.
+	ds, err := NewDecayed(0.01, 10000, math.Ln2/60)
+	assert.NoError(err)
+	ds.Now = clock.Now
+
+	for i := 0; i < 1000; i++ {
+		assert.NoError(ds.Push(0, 1))
+	}
+	clock.Advance(time.Minute)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(ds.Push(1, 1))
+	}
+
+	sum := ds.Snapshot()
+	assert.InDelta(3000, sum.TotalWeight(), 1e-6)
+	cdf, _, _ := sum.CDF(0)
+	assert.InDelta(1.0/3, cdf, 1e-9)
+	quantiles := ds.GenerateQuantiles(10)
+	assert.Equal(0.0, quantiles[3])
+	assert.Equal(1.0, quantiles[4])
+	q, err := ds.Quantile(0.5)
+	assert.NoError(err)
+	assert.Equal(1.0, q)
+}
+
+func TestDecayedSketchRenormalize(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	ds, err := NewDecayed(0.01, 1<<16, 1)
+	assert.NoError(err)
+
+	// Without renormalization weights would reach exp(2000) and overflow.
+	for i := 0; i < 20000; i++ {
+		at := start.Add(time.Duration(i) * 100 * time.Millisecond)
+		assert.NoError(ds.PushAt(at, float64(i), 1))
+	}
+	assert.True(ds.landmark.After(start))
+
+	sum := ds.Snapshot()
+	w := sum.TotalWeight()
+	assert.False(math.IsInf(w, 0) || math.IsNaN(w), "total weight %v", w)
+	// With a decay of e per second only the last few seconds matter.
+	q, err := ds.Quantile(0.5)
+	assert.NoError(err)
+	assert.True(q > 19900, "median %v", q)
+	assert.NoError(validateEntries(sum.entries))
+}
+
+func TestDecayedSketchNoDecay(t *testing.T) {
+	assert := assert.New(t)
+	ds, err := NewDecayed(0.01, 1<<16, 0)
+	assert.NoError(err)
+	stream, err := New(0.01, 1<<16)
+	assert.NoError(err)
+	totalWeight := 0.0
+	assert.NoError(generateFixedNonUniformSummary(0, 1<<16, &totalWeight, stream))
+	for i := int64(0); i < 1<<16; i++ {
+		x := float64(i) / (1 << 16)
+		assert.NoError(ds.Push(x, x))
+	}
+	expected, err := stream.GenerateQuantiles(10)
+	assert.NoError(err)
+	assert.Equal(expected, ds.GenerateQuantiles(10))
+}
+
+func TestDecayedSketchPolicy(t *testing.T) {
+	assert := assert.New(t)
+	ds, err := NewDecayed(0.01, 1000, 1)
+	assert.NoError(err)
+	assert.NoError(ds.Push(math.NaN(), 1))
+	ds.Policy.Weights = RejectInput
+	assert.True(errors.Is(ds.Push(1, -1), ErrInvalidInput))
+	assert.Equal(InvalidInputs{Rejected: 1, Dropped: 1}, ds.InvalidInputs())
+}
+
+func BenchmarkDecayedQuantile(b *testing.B) {
+	clock := &fakeClock{now: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ds, err := NewDecayed(0.01, 1<<23, 0.01)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ds.Now = clock.Now
+	for i := 0; i < 5000000; i++ {
+		if err := ds.Push(rand.Float64(), 1); err != nil {
+			b.Fatal(err)
+		}
+		clock.Advance(time.Millisecond)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ds.Quantile(0.99); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/axiomhq/quantiles/exact"
+)
+
+// distribution generates a data set of n points.
+type distribution struct {
+	name     string
+	generate func(rng *rand.Rand, n int) []exact.Point
+}
+
+// unweighted generates n points of weight 1 from a value generator.
+func unweighted(value func(rng *rand.Rand, i, n int) float64) func(*rand.Rand, int) []exact.Point {
+	return func(rng *rand.Rand, n int) []exact.Point {
+		points := make([]exact.Point, n)
+		for i := range points {
+			points[i] = exact.Point{Value: value(rng, i, n), Weight: 1}
+		}
+		return points
+	}
+}
+
+var distributions = []distribution{
+	{"uniform", unweighted(func(rng *rand.Rand, i, n int) float64 {
+		return rng.Float64()
+	})},
+	{"pareto", unweighted(func(rng *rand.Rand, i, n int) float64 {
+		// Pareto with scale 1 and shape 1.16, the 80-20 rule.
+		return math.Pow(1-rng.Float64(), -1/1.16)
+	})},
+	{"bimodal", unweighted(func(rng *rand.Rand, i, n int) float64 {
+		if rng.Intn(4) == 0 {
+			return 1000 + 50*rng.NormFloat64()
+		}
+		return 100 + 10*rng.NormFloat64()
+	})},
+	{"sorted", unweighted(func(rng *rand.Rand, i, n int) float64 {
+		return float64(i)
+	})},
+	{"reversed", unweighted(func(rng *rand.Rand, i, n int) float64 {
+		return float64(n - i)
+	})},
+	{"duplicates", unweighted(func(rng *rand.Rand, i, n int) float64 {
+		return float64(rng.Intn(10))
+	})},
+	{"weighted", func(rng *rand.Rand, n int) []exact.Point {
+		points := make([]exact.Point, n)
+		for i := range points {
+			points[i] = exact.Point{Value: rng.ExpFloat64(), Weight: float64(1 + rng.Intn(10))}
+		}
+		return points
+	}},
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/axiomhq/quantiles"
+	"github.com/beorn7/perks/quantile"
+	"github.com/stripe/veneur/tdigest"
+)
+
+// estimator is a streaming quantile estimator under test.
+type estimator interface {
+	push(value, weight float64) error
+	// finish is called once all points are pushed.
+	finish() error
+	quantile(q float64) (float64, error)
+	// serialize returns the estimator's state in its native serialization.
+	serialize() ([]byte, error)
+}
+
+// estimatorConfig holds the accuracy parameters of all estimators.
+type estimatorConfig struct {
+	eps         float64
+	compression float64
+	quantiles   []float64
+}
+
+type newEstimator struct {
+	name string
+	new  func(cfg estimatorConfig, n int) (estimator, error)
+}
+
+var estimators = []newEstimator{
+	{"axiom", func(cfg estimatorConfig, n int) (estimator, error) {
+		sketch, err := quantiles.New(cfg.eps, int64(n))
+		return &axiomEstimator{sketch: sketch}, err
+	}},
+	{"veneur", func(cfg estimatorConfig, n int) (estimator, error) {
+		return &veneurEstimator{tdigest.NewMerging(cfg.compression, false)}, nil
+	}},
+	{"perks", func(cfg estimatorConfig, n int) (estimator, error) {
+		targets := make(map[float64]float64, len(cfg.quantiles))
+		for _, q := range cfg.quantiles {
+			targets[q] = cfg.eps
+		}
+		return &perksEstimator{quantile.NewTargeted(targets)}, nil
+	}},
+}
+
+type axiomEstimator struct {
+	sketch *quantiles.Sketch
+	sum    *quantiles.Summary
+}
+
+func (e *axiomEstimator) push(value, weight float64) error {
+	return e.sketch.Push(value, weight)
+}
+
+func (e *axiomEstimator) finish() error {
+	if err := e.sketch.Finalize(); err != nil {
+		return err
+	}
+	sum, err := e.sketch.FinalSummary()
+	e.sum = sum
+	return err
+}
+
+func (e *axiomEstimator) quantile(q float64) (float64, error) {
+	value, _, _, err := e.sum.QuantileWithBounds(q)
+	return value, err
+}
+
+func (e *axiomEstimator) serialize() ([]byte, error) {
+	return e.sum.MarshalBinary()
+}
+
+type veneurEstimator struct {
+	td *tdigest.MergingDigest
+}
+
+func (e *veneurEstimator) push(value, weight float64) error {
+	e.td.Add(value, weight)
+	return nil
+}
+
+func (e *veneurEstimator) finish() error {
+	return nil
+}
+
+func (e *veneurEstimator) quantile(q float64) (float64, error) {
+	return e.td.Quantile(q), nil
+}
+
+func (e *veneurEstimator) serialize() ([]byte, error) {
+	return e.td.GobEncode()
+}
+
+// perksEstimator targets the queried quantiles. Perks doesn't support
+// weights, so weighted values are inserted repeatedly.
+type perksEstimator struct {
+	stream *quantile.Stream
+}
+
+func (e *perksEstimator) push(value, weight float64) error {
+	for i := 0.0; i < weight; i++ {
+		e.stream.Insert(value)
+	}
+	return nil
+}
+
+func (e *perksEstimator) finish() error {
+	return nil
+}
+
+func (e *perksEstimator) quantile(q float64) (float64, error) {
+	return e.stream.Query(q), nil
+}
+
+func (e *perksEstimator) serialize() ([]byte, error) {
+	return json.Marshal(e.stream.Samples())
+}
@@ -1,49 +1,168 @@
+/*
+Command demo compares the accuracy and performance of this package with
+the t-digest of stripe/veneur and the CKMS stream of beorn7/perks.
+
+Every estimator summarizes the data sets of several distributions. For
+each run the harness reports the wall time and allocations of pushing all
+points and finalizing, the size of the serialized state and the rank
+error of the estimated quantiles, i.e. how far the rank of an estimate is
+off from the requested rank as a fraction of the total weight.
+
+Usage:
+
+	go run ./demo [-n 1000000] [-eps 0.001] [-format table|csv]
+*/
 package main
 
 import (
+	"encoding/csv"
+	"flag"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
-	"github.com/axiomhq/quantiles"
-	"github.com/beorn7/perks/quantile"
-	"github.com/stripe/veneur/tdigest"
+	"github.com/axiomhq/quantiles/exact"
 )
 
-func bToMb(b uint64) uint64 {
-	return b / 1024 / 1024
+// result is the outcome of a single run.
+type result struct {
+	distribution, estimator string
+	duration                time.Duration
+	allocs, allocBytes      uint64
+	size                    int
+	maxErr, meanErr         float64
 }
 
-func veneur() {
-	t := tdigest.NewMerging(20, false)
-	now := time.Now()
-	for i := 0.0; i < 1e6; i++ {
-		t.Add(i, 1.0)
+// measure summarizes points with an estimator and evaluates the estimates.
+func measure(newEst newEstimator, cfg estimatorConfig, points []exact.Point, data *exact.Data) (result, error) {
+	res := result{estimator: newEst.name}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	est, err := newEst.new(cfg, len(points))
+	if err != nil {
+		return res, err
 	}
-	fmt.Println("veneur:", time.Since(now))
-}
+	for _, p := range points {
+		if err := est.push(p.Value, p.Weight); err != nil {
+			return res, err
+		}
+	}
+	if err := est.finish(); err != nil {
+		return res, err
+	}
+	res.duration = time.Since(start)
+	runtime.ReadMemStats(&after)
+	res.allocs = after.Mallocs - before.Mallocs
+	res.allocBytes = after.TotalAlloc - before.TotalAlloc
+
+	serialized, err := est.serialize()
+	if err != nil {
+		return res, err
+	}
+	res.size = len(serialized)
 
-func axiom() {
-	qstream, _ := quantiles.New(0.01, 1000)
-	now := time.Now()
-	for i := 0.0; i < 1e6; i++ {
-		if err := qstream.Push(i, 1.0); err != nil {
-			panic(err)
+	for _, q := range cfg.quantiles {
+		estimate, err := est.quantile(q)
+		if err != nil {
+			return res, err
+		}
+		rankErr := data.RankError(q, estimate)
+		if rankErr > res.maxErr {
+			res.maxErr = rankErr
 		}
+		res.meanErr += rankErr / float64(len(cfg.quantiles))
 	}
-	fmt.Println("axiom:", time.Since(now))
+	return res, nil
 }
 
-func prom() {
-	tstream := quantile.NewLowBiased(0.01)
-	now := time.Now()
-	for i := 0.0; i < 1e6; i++ {
-		tstream.Insert(i)
+var header = []string{"distribution", "estimator", "time", "allocs", "alloc bytes", "size", "max rank error", "mean rank error"}
+
+func (res result) fields() []string {
+	return []string{
+		res.distribution,
+		res.estimator,
+		res.duration.String(),
+		strconv.FormatUint(res.allocs, 10),
+		strconv.FormatUint(res.allocBytes, 10),
+		strconv.Itoa(res.size),
+		strconv.FormatFloat(res.maxErr, 'g', 3, 64),
+		strconv.FormatFloat(res.meanErr, 'g', 3, 64),
 	}
-	fmt.Println("prometheus:", time.Since(now))
+}
+
+func writeTable(w io.Writer, results []result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+	for _, res := range results {
+		fmt.Fprintln(tw, strings.Join(res.fields(), "\t")+"\t")
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, results []result) error {
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, res := range results {
+		cw.Write(res.fields())
+	}
+	cw.Flush()
+	return cw.Error()
 }
 
 func main() {
-	veneur()
-	prom()
-	axiom()
+	n := flag.Int("n", 1000000, "number of points per distribution")
+	seed := flag.Int64("seed", 1, "seed of the random distributions")
+	cfg := estimatorConfig{
+		quantiles: []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999},
+	}
+	flag.Float64Var(&cfg.eps, "eps", 0.001, "approximation error of this package and of perks")
+	flag.Float64Var(&cfg.compression, "compression", 100, "compression of the t-digest")
+	only := flag.String("distributions", "", "comma separated distributions to run, all if empty")
+	format := flag.String("format", "table", "output format, table or csv")
+	flag.Parse()
+
+	write := writeTable
+	switch *format {
+	case "table":
+	case "csv":
+		write = writeCSV
+	default:
+		fmt.Fprintf(os.Stderr, "demo: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	var results []result
+	for _, dist := range distributions {
+		if *only != "" && !strings.Contains(","+*only+",", ","+dist.name+",") {
+			continue
+		}
+		points := dist.generate(rand.New(rand.NewSource(*seed)), *n)
+		data, err := exact.New(points)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "demo: %v: %v\n", dist.name, err)
+			os.Exit(1)
+		}
+		for _, newEst := range estimators {
+			res, err := measure(newEst, cfg, points, data)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "demo: %v/%v: %v\n", dist.name, newEst.name, err)
+				os.Exit(1)
+			}
+			res.distribution = dist.name
+			results = append(results, res)
+		}
+	}
+	if err := write(os.Stdout, results); err != nil {
+		fmt.Fprintln(os.Stderr, "demo:", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,322 @@
+package quantiles
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Binary encoding versions. The version is the first byte of every encoded
+// Summary or Sketch and must be bumped whenever the layout changes.
+const (
+	summaryEncodingVersion uint8 = 1
+	// Version 2 of the sketch encoding appends the counters of invalid inputs.
+	sketchEncodingVersion uint8 = 2
+)
+
+// encoder appends little-endian fixed-width values to a byte slice.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) putUint8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) putUint64(v uint64) {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	e.buf = append(e.buf, tmp[:]...)
+}
+
+func (e *encoder) putInt64(v int64) {
+	e.putUint64(uint64(v))
+}
+
+func (e *encoder) putFloat64(v float64) {
+	e.putUint64(math.Float64bits(v))
+}
+
+func (e *encoder) putBool(v bool) {
+	if v {
+		e.putUint8(1)
+	} else {
+		e.putUint8(0)
+	}
+}
+
+func (e *encoder) putEntries(entries []SumEntry) {
+	e.putUint64(uint64(len(entries)))
+	for _, entry := range entries {
+		e.putFloat64(entry.value)
+		e.putFloat64(entry.weight)
+		e.putFloat64(entry.minRank)
+		e.putFloat64(entry.maxRank)
+	}
+}
+
+// decoder reads values written by encoder. The first failure is sticky and
+// turns every subsequent read into a no-op returning the zero value.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = fmt.Errorf("unexpected end of data: need %v bytes, have %v", n, len(d.buf))
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) uint8() uint8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (d *decoder) int64() int64 {
+	return int64(d.uint64())
+}
+
+func (d *decoder) float64() float64 {
+	return math.Float64frombits(d.uint64())
+}
+
+func (d *decoder) bool() bool {
+	switch v := d.uint8(); v {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("invalid boolean value: %v", v)
+		}
+		return false
+	}
+}
+
+// count reads a length prefix and checks that at least count*size bytes
+// remain so corrupt input can't trigger huge allocations.
+func (d *decoder) count(size int) int {
+	n := d.uint64()
+	if d.err != nil {
+		return 0
+	}
+	if n > uint64(len(d.buf)/size) {
+		d.err = fmt.Errorf("invalid length %v for %v remaining bytes", n, len(d.buf))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) entries() []SumEntry {
+	entries := make([]SumEntry, d.count(32))
+	for i := range entries {
+		entries[i] = SumEntry{
+			value:   d.float64(),
+			weight:  d.float64(),
+			minRank: d.float64(),
+			maxRank: d.float64(),
+		}
+	}
+	return entries
+}
+
+// done reports the sticky error, or an error if unread bytes remain.
+func (d *decoder) done() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) != 0 {
+		return fmt.Errorf("%v trailing bytes after decoding", len(d.buf))
+	}
+	return nil
+}
+
+// validateSketchSpecs checks the parameters of a decoded sketch.
+func validateSketchSpecs(eps float64, blockSize, maxLevels, maxSize, curSize int64) error {
+	if !(eps > 0 && eps < 1) || blockSize < 2 || maxLevels < 1 {
+		return fmt.Errorf("invalid sketch parameters: eps=%v, blockSize=%v, maxLevels=%v",
+			eps, blockSize, maxLevels)
+	}
+	if maxSize <= 0 || maxSize > blockSize<<1 || curSize < 0 || curSize >= maxSize {
+		return fmt.Errorf("invalid buffer specification: (%v, %v)", maxSize, curSize)
+	}
+	return nil
+}
+
+// validateBufEntry checks an entry of a decoded buffer, Push only buffers numbers with positive finite weights.
+func validateBufEntry(i int, e bufEntry) error {
+	if e.value != e.value {
+		return fmt.Errorf("NaN value in buffer entry %v", i)
+	}
+	if !(e.weight > 0) || math.IsInf(e.weight, 1) {
+		return fmt.Errorf("invalid weight %v in buffer entry %v", e.weight, i)
+	}
+	return nil
+}
+
+func (sum *Summary) encode(e *encoder) {
+	e.putUint64(sum.n)
+	e.putEntries(sum.entries)
+}
+
+func (sum *Summary) decode(d *decoder) {
+	sum.n = d.uint64()
+	sum.entries = d.entries()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (sum *Summary) MarshalBinary() ([]byte, error) {
+	e := &encoder{buf: make([]byte, 0, 17+32*len(sum.entries))}
+	e.putUint8(summaryEncodingVersion)
+	sum.encode(e)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (sum *Summary) UnmarshalBinary(data []byte) error {
+	d := &decoder{buf: data}
+	if v := d.uint8(); d.err == nil && v != summaryEncodingVersion {
+		return fmt.Errorf("unsupported summary encoding version: %v", v)
+	}
+	tmp := newSummary()
+	tmp.decode(d)
+	if err := d.done(); err != nil {
+		return err
+	}
+	if err := validateEntries(tmp.entries); err != nil {
+		return fmt.Errorf("invalid summary: %v", err)
+	}
+	*sum = *tmp
+	return nil
+}
+
+/*
+MarshalBinary implements encoding.BinaryMarshaler.
+The encoding captures the complete state of the sketch, including the
+pending buffer and every summary level, so a sketch can be checkpointed
+and resumed with UnmarshalBinary without altering any later result.
+*/
+func (stream *Sketch) MarshalBinary() ([]byte, error) {
+	e := &encoder{}
+	e.putUint8(sketchEncodingVersion)
+	e.putFloat64(stream.eps)
+	e.putInt64(stream.blockSize)
+	e.putInt64(stream.maxLevels)
+	e.putUint64(stream.n)
+	e.putBool(stream.finalized)
+
+	buf := stream.buffer
+	e.putInt64(buf.maxSize)
+	e.putUint64(uint64(buf.curSize))
+	for _, entry := range buf.vec[:buf.curSize] {
+		e.putFloat64(entry.value)
+		e.putFloat64(entry.weight)
+	}
+
+	stream.localSummary.encode(e)
+	e.putUint64(uint64(len(stream.summaryLevels)))
+	for _, level := range stream.summaryLevels {
+		level.encode(e)
+	}
+	e.putUint64(stream.invalid.Rejected)
+	e.putUint64(stream.invalid.Dropped)
+	e.putUint64(stream.invalid.Clamped)
+	e.putUint64(stream.invalid.ZeroWeights)
+	return e.buf, nil
+}
+
+/*
+UnmarshalBinary implements encoding.BinaryUnmarshaler.
+The Policy isn't part of the encoding: the receiver keeps its own, a zero
+Sketch gets the default one of New. Sketches encoded before the counters
+of invalid inputs were added decode with zero counters.
+*/
+func (stream *Sketch) UnmarshalBinary(data []byte) error {
+	d := &decoder{buf: data}
+	v := d.uint8()
+	if d.err == nil && (v < 1 || v > sketchEncodingVersion) {
+		return fmt.Errorf("unsupported sketch encoding version: %v", v)
+	}
+
+	tmp := &Sketch{
+		eps:       d.float64(),
+		blockSize: d.int64(),
+		maxLevels: d.int64(),
+		n:         d.uint64(),
+		finalized: d.bool(),
+	}
+
+	maxSize := d.int64()
+	curSize := d.count(16)
+	if d.err != nil {
+		return d.err
+	}
+	if err := validateSketchSpecs(tmp.eps, tmp.blockSize, tmp.maxLevels, maxSize, int64(curSize)); err != nil {
+		return err
+	}
+	tmp.buffer = &buffer{
+		maxSize: maxSize,
+		curSize: int64(curSize),
+		vec:     make([]bufEntry, maxSize),
+	}
+	for i := 0; i < curSize; i++ {
+		tmp.buffer.vec[i] = bufEntry{value: d.float64(), weight: d.float64()}
+		if d.err != nil {
+			return d.err
+		}
+		if err := validateBufEntry(i, tmp.buffer.vec[i]); err != nil {
+			return err
+		}
+	}
+
+	tmp.localSummary = newSummary()
+	tmp.localSummary.decode(d)
+	numLevels := d.count(16)
+	tmp.summaryLevels = make([]*Summary, numLevels)
+	for i := range tmp.summaryLevels {
+		tmp.summaryLevels[i] = newSummary()
+		tmp.summaryLevels[i].decode(d)
+	}
+	if v >= 2 {
+		tmp.invalid = InvalidInputs{
+			Rejected:    d.uint64(),
+			Dropped:     d.uint64(),
+			Clamped:     d.uint64(),
+			ZeroWeights: d.uint64(),
+		}
+	}
+	if err := d.done(); err != nil {
+		return err
+	}
+	if err := validateEntries(tmp.localSummary.entries); err != nil {
+		return fmt.Errorf("invalid local summary: %v", err)
+	}
+	for i, level := range tmp.summaryLevels {
+		if err := validateEntries(level.entries); err != nil {
+			return fmt.Errorf("invalid summary at level %v: %v", i, err)
+		}
+	}
+	tmp.Policy = stream.decodedPolicy()
+	*stream = *tmp
+	return nil
+}
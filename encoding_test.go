@@ -0,0 +1,175 @@
+package quantiles
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummaryBinaryRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	wqsd, err := NewWeightedQuantilesSummaryDummy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := &Summary{}
+	sum.buildFromBufferEntries(wqsd.buffer1.generateEntryList())
+	sum.compress(5, 0)
+	sum.n = 10
+
+	data, err := sum.MarshalBinary()
+	assert.NoError(err)
+
+	got := &Summary{}
+	assert.NoError(got.UnmarshalBinary(data))
+	assert.Equal(sum.entries, got.entries)
+	assert.Equal(sum.n, got.n)
+	assert.Equal(sum.ApproximationError(), got.ApproximationError())
+}
+
+func TestSummaryBinaryInvalid(t *testing.T) {
+	assert := assert.New(t)
+	sum := &Summary{}
+	sum.buildFromBufferEntries([]bufEntry{{1, 1}, {2, 1}})
+	data, err := sum.MarshalBinary()
+	assert.NoError(err)
+
+	got := &Summary{}
+	assert.Error(got.UnmarshalBinary(nil))
+	assert.Error(got.UnmarshalBinary(data[:len(data)-1]))
+	assert.Error(got.UnmarshalBinary(append(data, 0)))
+
+	bad := append([]byte{}, data...)
+	bad[0] = 0xff
+	assert.Error(got.UnmarshalBinary(bad))
+
+	// Entries are checked for NaN values and rank invariants.
+	bad = append([]byte{}, data...)
+	binary.LittleEndian.PutUint64(bad[17+32:], math.Float64bits(math.NaN()))
+	assert.EqualError(got.UnmarshalBinary(bad), "invalid summary: entry 1: value is NaN")
+	bad = append([]byte{}, data...)
+	binary.LittleEndian.PutUint64(bad[17+24:], math.Float64bits(0))
+	assert.EqualError(got.UnmarshalBinary(bad), "invalid summary: entry 0: minRank 0 + weight 1 exceeds maxRank 0")
+	assert.Nil(got.entries)
+}
+
+func TestSketchBinaryResume(t *testing.T) {
+	assert := assert.New(t)
+	values := make([]float64, 50000)
+	for i := range values {
+		values[i] = rand.Float64()
+	}
+
+	stream, err := New(0.01, int64(len(values)))
+	assert.NoError(err)
+	// Stop half way through a block so the buffer is partially filled.
+	half := len(values)/2 + 7
+	for _, v := range values[:half] {
+		assert.NoError(stream.Push(v, 1))
+	}
+	data, err := stream.MarshalBinary()
+	assert.NoError(err)
+
+	resumed := &Sketch{}
+	assert.NoError(resumed.UnmarshalBinary(data))
+	assert.Equal(stream.MaxDepth(), resumed.MaxDepth())
+	for _, v := range values[half:] {
+		assert.NoError(stream.Push(v, 1))
+		assert.NoError(resumed.Push(v, 1))
+	}
+	assert.NoError(stream.Finalize())
+	assert.NoError(resumed.Finalize())
+
+	expected, err := stream.MarshalBinary()
+	assert.NoError(err)
+	got, err := resumed.MarshalBinary()
+	assert.NoError(err)
+	assert.Equal(expected, got)
+
+	expectedQuantiles, _ := stream.GenerateQuantiles(10)
+	gotQuantiles, _ := resumed.GenerateQuantiles(10)
+	assert.Equal(expectedQuantiles, gotQuantiles)
+
+	// A finalized sketch round-trips as well.
+	final := &Sketch{}
+	assert.NoError(final.UnmarshalBinary(got))
+	q, err := final.Quantile(0.5)
+	assert.NoError(err)
+	expectedQ, _ := stream.Quantile(0.5)
+	assert.Equal(expectedQ, q)
+	assert.Equal(ErrFinalized, final.Push(1, 1))
+}
+
+func TestSketchBinaryInvalid(t *testing.T) {
+	assert := assert.New(t)
+	stream := NewDefault()
+	for i := 0.0; i < 100; i++ {
+		assert.NoError(stream.Push(i, 1))
+	}
+	data, err := stream.MarshalBinary()
+	assert.NoError(err)
+
+	got := &Sketch{}
+	assert.Error(got.UnmarshalBinary(data[:1]))
+	assert.Error(got.UnmarshalBinary(data[:len(data)-3]))
+
+	// Corrupt the epsilon.
+	bad := append([]byte{}, data...)
+	for i := 1; i < 9; i++ {
+		bad[i] = 0
+	}
+	assert.Error(got.UnmarshalBinary(bad))
+	binary.LittleEndian.PutUint64(bad[1:], math.Float64bits(math.NaN()))
+	assert.Error(got.UnmarshalBinary(bad))
+	assert.Nil(got.buffer)
+
+	// Corrupt the first buffer entry.
+	bad = append([]byte{}, data...)
+	binary.LittleEndian.PutUint64(bad[50:], math.Float64bits(math.NaN()))
+	assert.EqualError(got.UnmarshalBinary(bad), "NaN value in buffer entry 0")
+	bad = append([]byte{}, data...)
+	binary.LittleEndian.PutUint64(bad[58:], math.Float64bits(math.Inf(1)))
+	assert.EqualError(got.UnmarshalBinary(bad), "invalid weight +Inf in buffer entry 0")
+
+	// Corrupt the first entry of the local summary of a finalized sketch.
+	assert.NoError(stream.Finalize())
+	data, err = stream.MarshalBinary()
+	assert.NoError(err)
+	assert.NoError(got.UnmarshalBinary(data))
+	bad = append([]byte{}, data...)
+	binary.LittleEndian.PutUint64(bad[66:], math.Float64bits(math.NaN()))
+	assert.EqualError(got.UnmarshalBinary(bad), "invalid local summary: entry 0: value is NaN")
+}
+
+func TestSketchBinaryPolicyAndCounters(t *testing.T) {
+	assert := assert.New(t)
+	stream := NewDefault()
+	for i := 0.0; i < 100; i++ {
+		assert.NoError(stream.Push(i, 1))
+		assert.NoError(stream.Push(math.NaN(), 1))
+	}
+	data, err := stream.MarshalBinary()
+	assert.NoError(err)
+
+	// The receiver keeps its policy, the counters are restored.
+	got := NewDefault()
+	got.Policy.NaNValues = RejectInput
+	assert.NoError(got.UnmarshalBinary(data))
+	assert.Equal(RejectInput, got.Policy.NaNValues)
+	assert.Equal(InvalidInputs{Dropped: 100}, got.InvalidInputs())
+
+	// A zero Sketch gets the default policy.
+	got = &Sketch{}
+	assert.NoError(got.UnmarshalBinary(data))
+	assert.Equal(defaultInputPolicy, got.Policy)
+
+	// Version 1 had no counters.
+	v1 := append([]byte{1}, data[1:len(data)-32]...)
+	got = &Sketch{}
+	assert.NoError(got.UnmarshalBinary(v1))
+	assert.Equal(InvalidInputs{}, got.InvalidInputs())
+	assert.Equal(stream.n, got.n)
+}
@@ -0,0 +1,30 @@
+package quantiles
+
+import "errors"
+
+/*
+Errors returned by Sketch, Summary and the types built on them. Errors
+carrying more context wrap one of these, so callers should test for them
+with errors.Is rather than by comparing messages.
+*/
+var (
+	// ErrFinalized is returned when pushing into or merging into a finalized sketch.
+	ErrFinalized = errors.New("Finalize() already called")
+	// ErrNotFinalized is returned when querying a sketch before Finalize() was called.
+	ErrNotFinalized = errors.New("Finalize() must be called")
+	// ErrInvalidEpsilon is returned for approximation errors outside of (0, 1).
+	ErrInvalidEpsilon = errors.New("invalid epsilon")
+	// ErrInvalidLevel is returned for summary levels or rollup tiers that don't exist.
+	ErrInvalidLevel = errors.New("invalid level")
+	// ErrInvalidArgument is returned for other parameters out of range, e.g. a maxElements of zero.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrInvalidQuantile is returned for quantiles outside of [0, 1].
+	ErrInvalidQuantile = errors.New("invalid quantile")
+	// ErrInvalidInput is returned for inputs rejected by a sketch's InputPolicy.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrIncompatibleSketch matches every *IncompatibleSketchError.
+	ErrIncompatibleSketch = errors.New("incompatible sketches")
+)
+
+// errBufferFull is returned when pushing into a buffer that needs to be flushed first.
+var errBufferFull = errors.New("buffer already full")
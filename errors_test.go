@@ -0,0 +1,73 @@
+package quantiles
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New(0, 1000)
+	assert.True(errors.Is(err, ErrInvalidEpsilon))
+	_, err = New(1, 1000)
+	assert.True(errors.Is(err, ErrInvalidEpsilon))
+	_, err = New(math.NaN(), 1000)
+	assert.True(errors.Is(err, ErrInvalidEpsilon))
+	assert.True(errors.Is(newSummary().Compress(math.NaN()), ErrInvalidEpsilon))
+	_, err = New(0.01, 0)
+	assert.True(errors.Is(err, ErrInvalidArgument))
+	_, err = NewWindowed(0.01, 1000, 0, 5)
+	assert.True(errors.Is(err, ErrInvalidArgument))
+	_, err = NewRollup(0.01)
+	assert.True(errors.Is(err, ErrInvalidArgument))
+	assert.True(errors.Is(newSummary().Compress(0), ErrInvalidEpsilon))
+
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(stream.Push(float64(i), 1))
+	}
+	_, err = stream.Quantile(0.5)
+	assert.True(errors.Is(err, ErrNotFinalized))
+	_, _, _, err = stream.Rank(1)
+	assert.True(errors.Is(err, ErrNotFinalized))
+	_, err = stream.FinalSummary()
+	assert.True(errors.Is(err, ErrNotFinalized))
+	_, err = stream.ApproximationError(100)
+	assert.True(errors.Is(err, ErrInvalidLevel))
+
+	other, err := New(0.1, 1000)
+	assert.NoError(err)
+	err = stream.Merge(other)
+	assert.True(errors.Is(err, ErrIncompatibleSketch))
+	var incompatible *IncompatibleSketchError
+	if assert.True(errors.As(err, &incompatible)) {
+		assert.Equal(0.1, incompatible.OtherEps)
+	}
+
+	assert.NoError(stream.Finalize())
+	assert.True(errors.Is(stream.Push(1, 1), ErrFinalized))
+	assert.True(errors.Is(stream.Finalize(), ErrFinalized))
+	_, err = stream.ApproximationError(1)
+	assert.True(errors.Is(err, ErrInvalidLevel))
+	_, err = stream.Quantile(1.5)
+	assert.True(errors.Is(err, ErrInvalidQuantile))
+	_, _, _, err = stream.QuantileWithBounds(-0.5)
+	assert.True(errors.Is(err, ErrInvalidQuantile))
+
+	buf, err := newBuffer(1, 2)
+	assert.NoError(err)
+	assert.NoError(buf.push(1, 1))
+	assert.NoError(buf.push(2, 1))
+	assert.True(errors.Is(buf.push(3, 1), errBufferFull))
+
+	r, err := NewRollup(0.01, RollupTier{Resolution: time.Minute})
+	assert.NoError(err)
+	_, err = r.Buckets(1)
+	assert.True(errors.Is(err, ErrInvalidLevel))
+}
@@ -0,0 +1,205 @@
+/*
+Package exact computes exact weighted quantiles and ranks of raw data. It
+serves as an oracle for testing the accuracy of quantiles.Summary, e.g.
+
+	report, err := exact.Validate(summary, points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Error(err)
+	}
+*/
+package exact
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/axiomhq/quantiles"
+	"github.com/axiomhq/quantiles/internal/ranks"
+)
+
+// Point is a weighted value of a data set.
+type Point struct {
+	Value  float64
+	Weight float64
+}
+
+// Data holds a data set sorted by value for answering rank queries.
+type Data struct {
+	values []float64
+	// cumWeights[i] is the total weight of values[:i+1].
+	cumWeights []float64
+}
+
+// New returns the exact ranks of the given points, which must have non-NaN values and non-negative weights.
+func New(points []Point) (*Data, error) {
+	sorted := make([]Point, 0, len(points))
+	for i, p := range points {
+		if p.Value != p.Value || !(p.Weight >= 0) || math.IsInf(p.Weight, 1) {
+			return nil, fmt.Errorf("point %v: invalid value %v or weight %v", i, p.Value, p.Weight)
+		}
+		if p.Weight > 0 {
+			sorted = append(sorted, p)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Value < sorted[j].Value })
+
+	d := &Data{
+		values:     make([]float64, len(sorted)),
+		cumWeights: make([]float64, len(sorted)),
+	}
+	var cumWeight float64
+	for i, p := range sorted {
+		cumWeight += p.Weight
+		d.values[i] = p.Value
+		d.cumWeights[i] = cumWeight
+	}
+	return d, nil
+}
+
+// FromValues returns the exact ranks of values with a weight of 1 each.
+func FromValues(values ...float64) (*Data, error) {
+	points := make([]Point, len(values))
+	for i, v := range values {
+		points[i] = Point{v, 1}
+	}
+	return New(points)
+}
+
+// TotalWeight returns the total weight of the data set
+func (d *Data) TotalWeight() float64 {
+	if len(d.cumWeights) == 0 {
+		return 0
+	}
+	return d.cumWeights[len(d.cumWeights)-1]
+}
+
+/*
+Rank returns the total weight of the values less than value and the total
+weight of the values less than or equal to value. They differ by the
+weight of value itself.
+*/
+func (d *Data) Rank(value float64) (below, atOrBelow float64) {
+	if i := sort.SearchFloat64s(d.values, value); i > 0 {
+		below = d.cumWeights[i-1]
+	}
+	if i := sort.Search(len(d.values), func(i int) bool { return d.values[i] > value }); i > 0 {
+		atOrBelow = d.cumWeights[i-1]
+	}
+	return below, atOrBelow
+}
+
+/*
+Quantile returns the smallest value whose rank, the weight of the values
+less than or equal to it, is at least q * TotalWeight().
+*/
+func (d *Data) Quantile(q float64) (float64, error) {
+	if q < 0 || q > 1 {
+		return 0, fmt.Errorf("%w: expected 0 <= q <= 1, got q = %v", quantiles.ErrInvalidQuantile, q)
+	}
+	if len(d.values) == 0 {
+		return 0, nil
+	}
+	target := q * d.TotalWeight()
+	i := sort.Search(len(d.cumWeights), func(i int) bool { return d.cumWeights[i] >= target })
+	if i == len(d.values) {
+		i--
+	}
+	return d.values[i], nil
+}
+
+/*
+RankError returns how far estimate is off as quantile q, as a fraction of
+the total weight: the distance between q * TotalWeight() and the range of
+ranks [below, atOrBelow] estimate occupies in the data set. Estimates
+that aren't part of the data set are judged by the ranks they would have.
+*/
+func (d *Data) RankError(q, estimate float64) float64 {
+	totalWeight := d.TotalWeight()
+	if totalWeight == 0 {
+		return 0
+	}
+	target := q * totalWeight
+	below, atOrBelow := d.Rank(estimate)
+	switch {
+	case target < below:
+		return (below - target) / totalWeight
+	case target > atOrBelow:
+		return (target - atOrBelow) / totalWeight
+	}
+	return 0
+}
+
+// validateProbes is the number of evenly spaced quantiles probed by Validate.
+const validateProbes = 1000
+
+// Report is the outcome of Validate.
+type Report struct {
+	// ClaimedError is the summary's ApproximationError().
+	ClaimedError float64
+	// MaxRankError is the largest rank error of the probed quantiles, as
+	// a fraction of the total weight, and WorstQuantile the quantile it
+	// was observed for.
+	MaxRankError  float64
+	WorstQuantile float64
+	// RankBoundViolations counts the entries whose [minRank, maxRank]
+	// doesn't enclose the exact ranks of their value.
+	RankBoundViolations int
+}
+
+// Err returns an error describing the violated guarantees, if any.
+func (r Report) Err() error {
+	if r.RankBoundViolations > 0 {
+		return fmt.Errorf("%v entries have rank bounds not enclosing their exact ranks", r.RankBoundViolations)
+	}
+	if r.MaxRankError > r.ClaimedError+ranks.Tolerance {
+		return fmt.Errorf("rank error %v of quantile %v exceeds the approximation error %v",
+			r.MaxRankError, r.WorstQuantile, r.ClaimedError)
+	}
+	return nil
+}
+
+/*
+Validate checks a summary of points against their exact ranks. It probes
+evenly spaced quantiles with Summary.QuantileWithBounds and reports the
+largest rank error observed versus the claimed approximation error, and
+checks the rank bounds of every entry. It fails if the summary and the
+points have different total weights, as the ranks aren't comparable then.
+*/
+func Validate(sum *quantiles.Summary, points []Point) (Report, error) {
+	d, err := New(points)
+	if err != nil {
+		return Report{}, err
+	}
+	totalWeight := d.TotalWeight()
+	tol := ranks.Tolerance * math.Max(1, totalWeight)
+	if math.Abs(sum.TotalWeight()-totalWeight) > tol {
+		return Report{}, fmt.Errorf("summary has total weight %v, data %v", sum.TotalWeight(), totalWeight)
+	}
+
+	report := Report{ClaimedError: sum.ApproximationError()}
+	if totalWeight == 0 {
+		return report, nil
+	}
+	for i := 0; i <= validateProbes; i++ {
+		q := float64(i) / validateProbes
+		estimate, _, _, err := sum.QuantileWithBounds(q)
+		if err != nil {
+			return Report{}, err
+		}
+		if rankErr := d.RankError(q, estimate); rankErr > report.MaxRankError {
+			report.MaxRankError = rankErr
+			report.WorstQuantile = q
+		}
+	}
+	for _, e := range sum.Entries() {
+		below, atOrBelow := d.Rank(e.Value())
+		if e.MinRank() > below+tol || e.MaxRank() < atOrBelow-tol {
+			report.RankBoundViolations++
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,120 @@
+package exact
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/axiomhq/quantiles"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestData(t *testing.T) {
+	assert := assert.New(t)
+	d, err := New([]Point{{3, 1}, {1, 2}, {2, 0}, {3, 1}, {5, 4}})
+	assert.NoError(err)
+	assert.Equal(8.0, d.TotalWeight())
+
+	for _, tc := range []struct {
+		value, below, atOrBelow float64
+	}{
+		{0, 0, 0},
+		{1, 0, 2},
+		{2, 2, 2},
+		{3, 2, 4},
+		{4, 4, 4},
+		{5, 4, 8},
+		{6, 8, 8},
+	} {
+		below, atOrBelow := d.Rank(tc.value)
+		assert.Equal([]float64{tc.below, tc.atOrBelow}, []float64{below, atOrBelow}, "rank of %v", tc.value)
+	}
+
+	for _, tc := range []struct {
+		q, value float64
+	}{
+		{0, 1}, {0.25, 1}, {0.3, 3}, {0.5, 3}, {0.6, 5}, {1, 5},
+	} {
+		v, err := d.Quantile(tc.q)
+		assert.NoError(err)
+		assert.Equal(tc.value, v, "q = %v", tc.q)
+	}
+	_, err = d.Quantile(1.1)
+	assert.Error(err)
+
+	assert.Equal(0.0, d.RankError(0.5, 3))
+	assert.Equal(0.0, d.RankError(0.25, 1))
+	assert.Equal(0.125, d.RankError(0.125, 3))
+	assert.Equal(0.25, d.RankError(0.75, 3))
+	assert.Equal(0.25, d.RankError(0.75, 4))
+
+	_, err = New([]Point{{1, -1}})
+	assert.Error(err)
+	empty, err := FromValues()
+	assert.NoError(err)
+	v, err := empty.Quantile(0.5)
+	assert.NoError(err)
+	assert.Equal(0.0, v)
+}
+
+func TestValidateSketches(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for name, generate := range map[string]func(i int) Point{
+		"uniform":    func(i int) Point { return Point{rng.Float64(), 1} },
+		"sorted":     func(i int) Point { return Point{float64(i), 1} },
+		"weighted":   func(i int) Point { return Point{rng.ExpFloat64(), rng.Float64()} },
+		"duplicates": func(i int) Point { return Point{float64(rng.Intn(10)), 1} },
+	} {
+		points := make([]Point, 100000)
+		for i := range points {
+			points[i] = generate(i)
+		}
+		sketch, err := quantiles.New(0.01, int64(len(points)))
+		assert.NoError(t, err)
+		for _, p := range points {
+			assert.NoError(t, sketch.Push(p.Value, p.Weight))
+		}
+		assert.NoError(t, sketch.Finalize())
+		sum, err := sketch.FinalSummary()
+		assert.NoError(t, err)
+
+		report, err := Validate(sum, points)
+		assert.NoError(t, err, name)
+		assert.NoError(t, report.Err(), name)
+		assert.True(t, report.ClaimedError <= 0.01, name)
+	}
+}
+
+func summaryOf(t *testing.T, values ...float64) *quantiles.Summary {
+	entries := make([]quantiles.SumEntry, len(values))
+	for i, v := range values {
+		e, err := quantiles.NewSumEntry(v, 1, float64(i), float64(i+1))
+		assert.NoError(t, err)
+		entries[i] = e
+	}
+	sum, err := quantiles.NewSummaryFromEntries(entries)
+	assert.NoError(t, err)
+	return sum
+}
+
+func TestValidateDetectsViolations(t *testing.T) {
+	assert := assert.New(t)
+	points := []Point{{1, 1}, {2, 1}, {3, 1}, {4, 1}}
+
+	report, err := Validate(summaryOf(t, 1, 2, 3, 4), points)
+	assert.NoError(err)
+	assert.Equal(Report{}, report)
+	assert.NoError(report.Err())
+
+	// Claims 3 and 4 are the two smallest values.
+	report, err = Validate(summaryOf(t, 3, 4, 5, 6), points)
+	assert.NoError(err)
+	assert.Equal(3, report.RankBoundViolations)
+	assert.Equal(0.5, report.MaxRankError)
+	assert.Equal(0.0, report.WorstQuantile)
+	assert.Error(report.Err())
+
+	_, err = Validate(summaryOf(t, 1, 2), points)
+	assert.Error(err)
+	_, err = Validate(summaryOf(t, 1), []Point{{1, -1}})
+	assert.Error(err)
+}
@@ -0,0 +1,411 @@
+package quantiles
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricFamily is a named set of labelled series exposed as a summary metric.
+type MetricFamily struct {
+	Name string
+	Help string
+	// Objectives are the quantiles exposed for every series.
+	Objectives []float64
+	Series     []Series
+}
+
+/*
+WriteText renders the families in the Prometheus text exposition format
+(version 0.0.4) as summary metrics with a quantile line per objective
+followed by _sum and _count.
+*/
+func WriteText(w io.Writer, families ...MetricFamily) error {
+	return writeExposition(w, false, families)
+}
+
+/*
+WriteOpenMetrics renders the families in the OpenMetrics text format,
+terminated by the mandatory # EOF line.
+*/
+func WriteOpenMetrics(w io.Writer, families ...MetricFamily) error {
+	return writeExposition(w, true, families)
+}
+
+func writeExposition(w io.Writer, openMetrics bool, families []MetricFamily) error {
+	bw := bufio.NewWriter(w)
+	for _, mf := range families {
+		if err := writeFamily(bw, openMetrics, mf); err != nil {
+			return err
+		}
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+func writeFamily(w *bufio.Writer, openMetrics bool, mf MetricFamily) error {
+	if !validMetricName(mf.Name) {
+		return fmt.Errorf("invalid metric name %q", mf.Name)
+	}
+	for _, q := range mf.Objectives {
+		if !(q >= 0 && q <= 1) {
+			return fmt.Errorf("%v: %w: expected 0 <= objective <= 1, got %v", mf.Name, ErrInvalidQuantile, q)
+		}
+	}
+
+	if mf.Help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", mf.Name, escapeHelp(mf.Help, openMetrics))
+	}
+	fmt.Fprintf(w, "# TYPE %s summary\n", mf.Name)
+	for _, s := range mf.Series {
+		names := make([]string, 0, len(s.Labels))
+		for name := range s.Labels {
+			if !validLabelName(name) || name == "quantile" {
+				return fmt.Errorf("%v: invalid label name %q", mf.Name, name)
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var labels strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&labels, `%s="%s",`, name, escapeLabelValue(s.Labels[name]))
+		}
+
+		for _, q := range mf.Objectives {
+			v := math.NaN()
+			if s.Summary != nil && s.Summary.TotalWeight() > 0 {
+				v, _, _, _ = s.Summary.QuantileWithBounds(q)
+			}
+			fmt.Fprintf(w, "%s{%squantile=\"%s\"} %s\n", mf.Name, labels.String(), formatFloat(q), formatFloat(v))
+		}
+		trimmed := strings.TrimSuffix(labels.String(), ",")
+		if trimmed != "" {
+			trimmed = "{" + trimmed + "}"
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", mf.Name, trimmed, formatFloat(s.Sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", mf.Name, trimmed, s.Count)
+	}
+	return nil
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string, openMetrics bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if openMetrics {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func escapeLabelValue(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return strings.Replace(s, `"`, `\"`, -1)
+}
+
+func validMetricName(name string) bool {
+	for i, c := range name {
+		if !(c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func validLabelName(name string) bool {
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// parsedSeries collects the samples of a series while parsing.
+type parsedSeries struct {
+	labels    Labels
+	quantiles map[float64]float64
+	sum       float64
+	count     float64
+	hasCount  bool
+}
+
+type parsedFamily struct {
+	name   string
+	help   string
+	series map[string]*parsedSeries
+	order  []string
+}
+
+/*
+ParseText reads summary metrics in the Prometheus text or OpenMetrics
+format and rebuilds an approximate Summary for every series from its
+quantile lines. Each quantile value is pinned at the exact rank of its
+quantile by a zero-weight entry and the weight between two quantiles is
+left to the approximation error, so the rebuilt summary reproduces the
+exposed quantiles but not the accuracy of the original sketch. The _count
+sample must be a non-negative integer. Metrics of other types are skipped.
+*/
+func ParseText(r io.Reader) ([]MetricFamily, error) {
+	var (
+		families []*parsedFamily
+		byName   = map[string]*parsedFamily{}
+		help     = map[string]string{}
+	)
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[1] {
+			case "HELP":
+				if len(fields) == 4 {
+					help[fields[2]] = unescapeHelp(fields[3])
+				}
+			case "TYPE":
+				if len(fields) == 4 && fields[3] == "summary" && byName[fields[2]] == nil {
+					pf := &parsedFamily{name: fields[2], series: map[string]*parsedSeries{}}
+					byName[pf.name] = pf
+					families = append(families, pf)
+				}
+			}
+			continue
+		}
+
+		name, labels, value, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNum, err)
+		}
+		base, suffix := name, ""
+		for _, s := range []string{"_sum", "_count"} {
+			if strings.HasSuffix(name, s) && byName[strings.TrimSuffix(name, s)] != nil {
+				base, suffix = strings.TrimSuffix(name, s), s
+			}
+		}
+		pf := byName[base]
+		if pf == nil {
+			continue
+		}
+
+		var q float64
+		if suffix == "" {
+			qs, ok := labels["quantile"]
+			if !ok {
+				return nil, fmt.Errorf("line %v: summary sample without quantile label", lineNum)
+			}
+			if q, err = strconv.ParseFloat(qs, 64); err != nil || !(q >= 0 && q <= 1) {
+				return nil, fmt.Errorf("line %v: invalid quantile %q", lineNum, qs)
+			}
+			delete(labels, "quantile")
+		}
+
+		key := labels.key()
+		ps := pf.series[key]
+		if ps == nil {
+			ps = &parsedSeries{labels: labels, quantiles: map[float64]float64{}}
+			pf.series[key] = ps
+			pf.order = append(pf.order, key)
+		}
+		switch suffix {
+		case "_sum":
+			ps.sum = value
+		case "_count":
+			if !(value >= 0 && value < math.MaxUint64) || value != math.Trunc(value) {
+				return nil, fmt.Errorf("line %v: invalid count %v", lineNum, value)
+			}
+			ps.count, ps.hasCount = value, true
+		default:
+			ps.quantiles[q] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]MetricFamily, len(families))
+	for i, pf := range families {
+		mf := MetricFamily{Name: pf.name, Help: help[pf.name]}
+		objectives := map[float64]bool{}
+		for _, key := range pf.order {
+			ps := pf.series[key]
+			for q := range ps.quantiles {
+				objectives[q] = true
+			}
+			count := ps.count
+			if !ps.hasCount {
+				count = 1
+			}
+			mf.Series = append(mf.Series, Series{
+				Labels:  ps.labels,
+				Summary: summaryFromQuantiles(ps.quantiles, count),
+				Count:   uint64(count),
+				Sum:     ps.sum,
+			})
+		}
+		for q := range objectives {
+			mf.Objectives = append(mf.Objectives, q)
+		}
+		sort.Float64s(mf.Objectives)
+		result[i] = mf
+	}
+	return result, nil
+}
+
+/*
+summaryFromQuantiles builds a summary with the given total weight whose
+entries are the quantile values. Each value sits at the exact rank of its
+quantile, so the weight between two quantiles shows up as approximation
+error instead of being attributed to either value.
+*/
+func summaryFromQuantiles(points map[float64]float64, totalWeight float64) *Summary {
+	qs := make([]float64, 0, len(points))
+	for q, v := range points {
+		if !math.IsNaN(v) {
+			qs = append(qs, q)
+		}
+	}
+	sort.Float64s(qs)
+
+	sum := newSummary()
+	if len(qs) == 0 || !(totalWeight > 0) {
+		return sum
+	}
+	for _, q := range qs {
+		rank := q * totalWeight
+		v := points[q]
+		if n := len(sum.entries); n > 0 && v <= sum.entries[n-1].value {
+			// Quantile values must increase; ties and inversions widen the previous entry.
+			last := &sum.entries[n-1]
+			last.weight += rank - last.maxRank
+			last.maxRank = rank
+			continue
+		}
+		sum.entries = append(sum.entries, SumEntry{
+			value:   v,
+			minRank: rank,
+			maxRank: rank,
+		})
+	}
+	// Whatever weight lies above the last quantile is only known to rank it.
+	sum.entries[len(sum.entries)-1].maxRank = totalWeight
+	sum.n = uint64(totalWeight)
+	return sum
+}
+
+// parseSample parses a sample line: name{labels} value [timestamp].
+func parseSample(line string) (string, Labels, float64, error) {
+	labels := Labels{}
+	end := strings.IndexAny(line, "{ ")
+	if end <= 0 {
+		return "", nil, 0, fmt.Errorf("invalid sample %q", line)
+	}
+	name, rest := line[:end], line[end:]
+	if !validMetricName(name) {
+		return "", nil, 0, fmt.Errorf("invalid metric name %q", name)
+	}
+
+	if strings.HasPrefix(rest, "{") {
+		rest = rest[1:]
+		for {
+			rest = strings.TrimLeft(rest, " ,")
+			if strings.HasPrefix(rest, "}") {
+				rest = rest[1:]
+				break
+			}
+			eq := strings.Index(rest, "=")
+			if eq <= 0 || len(rest) < eq+2 || rest[eq+1] != '"' {
+				return "", nil, 0, fmt.Errorf("invalid labels in %q", line)
+			}
+			labelName := strings.TrimSpace(rest[:eq])
+			value, n, err := unescapeLabelValue(rest[eq+2:])
+			if err != nil {
+				return "", nil, 0, fmt.Errorf("%v in %q", err, line)
+			}
+			labels[labelName] = value
+			rest = rest[eq+2+n:]
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return "", nil, 0, fmt.Errorf("invalid sample %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid value %q", fields[0])
+	}
+	return name, labels, value, nil
+}
+
+// unescapeLabelValue reads a quoted label value up to and including the
+// closing quote and returns it along with the number of bytes consumed.
+func unescapeLabelValue(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, fmt.Errorf("unterminated escape")
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case '\\', '"':
+				b.WriteByte(s[i])
+			default:
+				return "", 0, fmt.Errorf("invalid escape \\%c", s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated label value")
+}
+
+func unescapeHelp(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '\\', '"':
+				b.WriteByte(s[i+1])
+				i++
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
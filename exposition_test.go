@@ -0,0 +1,162 @@
+package quantiles
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func exactSeries(labels Labels, values ...float64) Series {
+	entries := make([]bufEntry, len(values))
+	sum := 0.0
+	for i, v := range values {
+		entries[i] = bufEntry{v, 1}
+		sum += v
+	}
+	s := &Summary{n: uint64(len(values))}
+	s.buildFromBufferEntries(entries)
+	return Series{Labels: labels, Summary: s, Count: s.Count(), Sum: sum}
+}
+
+func TestWriteText(t *testing.T) {
+	assert := assert.New(t)
+	mf := MetricFamily{
+		Name:       "rpc_duration_seconds",
+		Help:       "RPC latency\nin \\seconds\".",
+		Objectives: []float64{0.5, 0.99},
+		Series: []Series{
+			exactSeries(Labels{"service": "a\"b", "code": "200"}, 1, 2, 3),
+			exactSeries(nil),
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(WriteText(&buf, mf))
+	assert.Equal(`# HELP rpc_duration_seconds RPC latency\nin \\seconds".
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{code="200",service="a\"b",quantile="0.5"} 2
+rpc_duration_seconds{code="200",service="a\"b",quantile="0.99"} 3
+rpc_duration_seconds_sum{code="200",service="a\"b"} 6
+rpc_duration_seconds_count{code="200",service="a\"b"} 3
+rpc_duration_seconds{quantile="0.5"} NaN
+rpc_duration_seconds{quantile="0.99"} NaN
+rpc_duration_seconds_sum 0
+rpc_duration_seconds_count 0
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(WriteOpenMetrics(&buf, mf))
+	assert.True(strings.HasPrefix(buf.String(), `# HELP rpc_duration_seconds RPC latency\nin \\seconds\".`))
+	assert.True(strings.HasSuffix(buf.String(), "# EOF\n"))
+
+	assert.Error(WriteText(&buf, MetricFamily{Name: "1abc"}))
+	assert.Error(WriteText(&buf, MetricFamily{Name: "abc", Objectives: []float64{2}}))
+	assert.Error(WriteText(&buf, MetricFamily{Name: "abc", Series: []Series{{Labels: Labels{"quantile": "x"}}}}))
+	assert.Error(WriteText(&buf, MetricFamily{Name: "abc", Series: []Series{{Labels: Labels{"a-b": "x"}}}}))
+}
+
+func TestParseTextRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	values := make([]float64, 1000)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	objectives := []float64{0, 0.1, 0.5, 0.9, 0.99, 1}
+	mf := MetricFamily{
+		Name:       "latency",
+		Help:       "Latency with \"quotes\" and \\.",
+		Objectives: objectives,
+		Series: []Series{
+			exactSeries(Labels{"path": "/a\nb"}, values...),
+			exactSeries(Labels{"path": "/c"}, 5),
+		},
+	}
+
+	for _, write := range []func(*bytes.Buffer) error{
+		func(buf *bytes.Buffer) error { return WriteText(buf, mf) },
+		func(buf *bytes.Buffer) error { return WriteOpenMetrics(buf, mf) },
+	} {
+		var buf bytes.Buffer
+		assert.NoError(write(&buf))
+		families, err := ParseText(&buf)
+		assert.NoError(err)
+		if !assert.Equal(1, len(families)) {
+			continue
+		}
+		got := families[0]
+		assert.Equal(mf.Name, got.Name)
+		assert.Equal(mf.Help, got.Help)
+		assert.Equal(objectives, got.Objectives)
+		if !assert.Equal(2, len(got.Series)) {
+			continue
+		}
+		s := got.Series[0]
+		assert.Equal(Labels{"path": "/a\nb"}, s.Labels)
+		assert.Equal(uint64(1000), s.Count)
+		assert.Equal(500500.0, s.Sum)
+		assert.Equal(1000.0, s.Summary.TotalWeight())
+		assert.NoError(validateEntries(s.Summary.entries))
+		for _, q := range objectives {
+			expected, _, _, err := mf.Series[0].Summary.QuantileWithBounds(q)
+			assert.NoError(err)
+			actual, _, _, err := s.Summary.QuantileWithBounds(q)
+			assert.NoError(err)
+			assert.InDelta(expected, actual, 1, "q = %v", q)
+		}
+		assert.Equal(5.0, got.Series[1].Summary.MinValue())
+		assert.Equal(5.0, got.Series[1].Summary.MaxValue())
+	}
+}
+
+func TestParseTextSkipsOtherMetrics(t *testing.T) {
+	assert := assert.New(t)
+	families, err := ParseText(strings.NewReader(`
+# TYPE http_requests_total counter
+http_requests_total{code="200"} 1027 1395066363000
+# TYPE go_gc_duration_seconds summary
+go_gc_duration_seconds{quantile="0"} 4.9351e-05
+go_gc_duration_seconds{quantile="0.5"} 0.000111
+go_gc_duration_seconds{quantile="1"} 0.011689149
+go_gc_duration_seconds{quantile="0.25"} +Inf
+go_gc_duration_seconds_sum 1.8
+go_gc_duration_seconds_count 100
+`))
+	assert.NoError(err)
+	if assert.Equal(1, len(families)) {
+		s := families[0].Series[0]
+		assert.Equal(uint64(100), s.Count)
+		assert.Equal(4.9351e-05, s.Summary.MinValue())
+		assert.True(math.IsInf(s.Summary.MaxValue(), 1))
+		assert.NoError(validateEntries(s.Summary.entries))
+		assert.NoError(s.Summary.Check(0))
+	}
+
+	// Huge counts are fine, Quantile doesn't allocate per element.
+	families, err = ParseText(strings.NewReader("# TYPE x summary\nx{quantile=\"0.5\"} 3\nx_count 1e17\n"))
+	assert.NoError(err)
+	if assert.Equal(1, len(families)) {
+		s := families[0].Series[0]
+		assert.Equal(uint64(1e17), s.Count)
+		q, err := s.Summary.Quantile(0.5)
+		assert.NoError(err)
+		assert.Equal(3.0, q)
+	}
+
+	for _, input := range []string{
+		"# TYPE x summary\nx 1\n",
+		"# TYPE x summary\nx{quantile=\"2\"} 1\n",
+		"# TYPE x summary\nx{quantile=\"0.5} 1\n",
+		"# TYPE x summary\nx{quantile=\"0.5\"} abc\n",
+		"# TYPE x summary\nx{quantile=\"0.5\"}\n",
+		"# TYPE x summary\nx_count -1\n",
+		"# TYPE x summary\nx_count 1.5\n",
+		"# TYPE x summary\nx_count NaN\n",
+		"# TYPE x summary\nx_count +Inf\n",
+	} {
+		_, err := ParseText(strings.NewReader(input))
+		assert.Error(err, input)
+	}
+}
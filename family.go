@@ -0,0 +1,262 @@
+package quantiles
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Labels identify a series of a Family, e.g. {"endpoint": "/", "status": "200"}.
+type Labels map[string]string
+
+/*
+key returns a canonical encoding of the labels, independent of map order.
+Names and values are prefixed with their length, as they may contain any
+byte.
+*/
+func (l Labels) key() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	write := func(s string) {
+		b.WriteString(strconv.Itoa(len(s)))
+		b.WriteByte(':')
+		b.WriteString(s)
+	}
+	for _, name := range names {
+		write(name)
+		write(l[name])
+	}
+	return b.String()
+}
+
+func (l Labels) clone() Labels {
+	c := make(Labels, len(l))
+	for name, value := range l {
+		c[name] = value
+	}
+	return c
+}
+
+// Series is a point-in-time view of a series of a Family.
+type Series struct {
+	Labels  Labels
+	Summary *Summary
+	// Count is the number of pushed values.
+	Count uint64
+	// Sum is the sum of the pushed values multiplied by their weights.
+	Sum float64
+}
+
+type familySeries struct {
+	key    string
+	labels Labels
+	sketch *Sketch
+	sum    float64
+}
+
+func (s *familySeries) view() Series {
+	sum := s.sketch.Snapshot()
+	return Series{
+		Labels:  s.labels.clone(),
+		Summary: sum,
+		Count:   s.sketch.n,
+		Sum:     s.sum,
+	}
+}
+
+/*
+Family is a set of sketches keyed by label sets, for computing quantiles
+of labelled metrics. Series are created lazily on their first push.
+If the number of series is capped, pushing a new series evicts the least
+recently pushed one. Family is safe for concurrent use.
+*/
+type Family struct {
+	// OnEvict, if set, is called with the final state of every evicted
+	// series. It must be set before the family is used.
+	OnEvict func(Series)
+	// Policy is applied by the sketches of series created after it is
+	// set, see Sketch.Policy.
+	Policy InputPolicy
+
+	eps         float64
+	maxElements int64
+	maxSeries   int
+	// removed counts the invalid inputs of evicted and deleted series.
+	removed InvalidInputs
+
+	mu        sync.Mutex
+	series    map[string]*list.Element
+	lru       *list.List // of *familySeries, most recently pushed first
+	finalized bool
+}
+
+/*
+NewFamily returns a new Family whose series are summarized with the given
+eps and maxElements. maxSeries caps the number of series, zero means no cap.
+*/
+func NewFamily(eps float64, maxElements int64, maxSeries int) (*Family, error) {
+	if maxSeries < 0 {
+		return nil, fmt.Errorf("%w: maxSeries should be >= 0, got %v", ErrInvalidArgument, maxSeries)
+	}
+	// Surface bad eps and maxElements now rather than on the first push.
+	if _, err := New(eps, maxElements); err != nil {
+		return nil, err
+	}
+	return &Family{
+		Policy:      defaultInputPolicy,
+		eps:         eps,
+		maxElements: maxElements,
+		maxSeries:   maxSeries,
+		series:      make(map[string]*list.Element),
+		lru:         list.New(),
+	}, nil
+}
+
+// Push a value and a weight into the series identified by labels
+func (f *Family) Push(labels Labels, value float64, weight float64) error {
+	evicted, err := f.push(labels, value, weight)
+	if evicted != nil && f.OnEvict != nil {
+		f.OnEvict(evicted.view())
+	}
+	return err
+}
+
+func (f *Family) push(labels Labels, value float64, weight float64) (*familySeries, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.finalized {
+		return nil, ErrFinalized
+	}
+
+	key := labels.key()
+	if elem, ok := f.series[key]; ok {
+		f.lru.MoveToFront(elem)
+		return nil, elem.Value.(*familySeries).push(value, weight)
+	}
+
+	sketch, err := New(f.eps, f.maxElements)
+	if err != nil {
+		return nil, err
+	}
+	sketch.Policy = f.Policy
+	s := &familySeries{key: key, labels: labels.clone(), sketch: sketch}
+	if err := s.push(value, weight); err != nil {
+		// Don't keep or make room for a series that holds nothing, but
+		// still count the rejected input.
+		f.removed.add(sketch.InvalidInputs())
+		return nil, err
+	}
+	var evicted *familySeries
+	if f.maxSeries > 0 && f.lru.Len() >= f.maxSeries {
+		evicted = f.lru.Remove(f.lru.Back()).(*familySeries)
+		delete(f.series, evicted.key)
+		f.removed.add(evicted.sketch.InvalidInputs())
+	}
+	f.series[key] = f.lru.PushFront(s)
+	return evicted, nil
+}
+
+func (s *familySeries) push(value float64, weight float64) error {
+	// Sum up what the sketch pushed, after clamping and without dropped inputs.
+	value, weight, ok, err := s.sketch.push(value, weight)
+	if err != nil {
+		return err
+	}
+	if ok && weight > 0 {
+		s.sum += value * weight
+	}
+	return nil
+}
+
+// Len returns the number of series
+func (f *Family) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lru.Len()
+}
+
+// Get returns the current state of the series identified by labels
+func (f *Family) Get(labels Labels) (Series, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	elem, ok := f.series[labels.key()]
+	if !ok {
+		return Series{}, false
+	}
+	return elem.Value.(*familySeries).view(), true
+}
+
+// Delete removes the series identified by labels and reports whether it existed
+func (f *Family) Delete(labels Labels) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := labels.key()
+	elem, ok := f.series[key]
+	if ok {
+		f.lru.Remove(elem)
+		delete(f.series, key)
+		f.removed.add(elem.Value.(*familySeries).sketch.InvalidInputs())
+	}
+	return ok
+}
+
+// InvalidInputs returns the counts of invalid inputs of all series so far.
+func (f *Family) InvalidInputs() InvalidInputs {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	invalid := f.removed
+	for elem := f.lru.Front(); elem != nil; elem = elem.Next() {
+		invalid.add(elem.Value.(*familySeries).sketch.InvalidInputs())
+	}
+	return invalid
+}
+
+// FinalizeAll finalizes every series; subsequent pushes fail.
+func (f *Family) FinalizeAll() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.finalized {
+		return ErrFinalized
+	}
+	f.finalized = true
+	for elem := f.lru.Front(); elem != nil; elem = elem.Next() {
+		if err := elem.Value.(*familySeries).sketch.Finalize(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Each calls fn with the current state of every series, ordered by labels.
+The state is captured up front, so fn may call back into the family.
+Iteration stops at the first error returned by fn.
+*/
+func (f *Family) Each(fn func(Series) error) error {
+	f.mu.Lock()
+	series := make([]*familySeries, 0, f.lru.Len())
+	for elem := f.lru.Front(); elem != nil; elem = elem.Next() {
+		series = append(series, elem.Value.(*familySeries))
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].key < series[j].key })
+	views := make([]Series, len(series))
+	for i, s := range series {
+		views[i] = s.view()
+	}
+	f.mu.Unlock()
+
+	for _, view := range views {
+		if err := fn(view); err != nil {
+			return err
+		}
+	}
+	return nil
+}
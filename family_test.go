@@ -0,0 +1,180 @@
+package quantiles
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelsKey(t *testing.T) {
+	assert := assert.New(t)
+	a := Labels{"endpoint": "/", "status": "200"}
+	b := Labels{"status": "200", "endpoint": "/"}
+	assert.Equal(a.key(), b.key())
+	assert.NotEqual(a.key(), Labels{"endpoint": "/", "status": "500"}.key())
+	assert.NotEqual(Labels{"a": "bc"}.key(), Labels{"ab": "c"}.key())
+	assert.NotEqual(Labels{"a": "b\xffc\xffd"}.key(), Labels{"a": "b", "c": "d"}.key())
+	assert.NotEqual(Labels{"a": "1:b"}.key(), Labels{"a": "", "b": ""}.key())
+	assert.Equal("", Labels{}.key())
+}
+
+func TestFamily(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewFamily(0.01, 1000, -1)
+	assert.Error(err)
+	_, err = NewFamily(0, 1000, 0)
+	assert.Error(err)
+
+	f, err := NewFamily(0.01, 1000, 0)
+	assert.NoError(err)
+	labels := Labels{"endpoint": "/api", "status": "200"}
+	for i := 1; i <= 100; i++ {
+		assert.NoError(f.Push(labels, float64(i), 1))
+		assert.NoError(f.Push(Labels{"endpoint": "/api", "status": "500"}, float64(-i), 2))
+	}
+	// Dropped inputs don't count towards the sum.
+	assert.NoError(f.Push(labels, math.NaN(), 1))
+	assert.Equal(2, f.Len())
+
+	// Mutating the caller's labels doesn't affect the family.
+	labels["status"] = "404"
+	s, ok := f.Get(Labels{"status": "200", "endpoint": "/api"})
+	assert.True(ok)
+	assert.Equal("200", s.Labels["status"])
+	assert.Equal(uint64(100), s.Count)
+	assert.Equal(5050.0, s.Sum)
+	assert.Equal(100.0, s.Summary.TotalWeight())
+	_, ok = f.Get(labels)
+	assert.False(ok)
+
+	var seen []string
+	assert.NoError(f.Each(func(s Series) error {
+		q, err := s.Summary.Quantile(0.5)
+		if err != nil {
+			return err
+		}
+		seen = append(seen, fmt.Sprintf("%v=%v", s.Labels["status"], q))
+		return nil
+	}))
+	assert.Equal([]string{"200=51", "500=-50"}, seen)
+
+	errStop := fmt.Errorf("stop")
+	calls := 0
+	assert.Equal(errStop, f.Each(func(Series) error {
+		calls++
+		return errStop
+	}))
+	assert.Equal(1, calls)
+
+	assert.True(f.Delete(Labels{"endpoint": "/api", "status": "500"}))
+	assert.False(f.Delete(Labels{"endpoint": "/api", "status": "500"}))
+	assert.Equal(1, f.Len())
+
+	assert.NoError(f.FinalizeAll())
+	assert.Equal(ErrFinalized, f.FinalizeAll())
+	assert.Equal(ErrFinalized, f.Push(Labels{"endpoint": "/new"}, 1, 1))
+	s, ok = f.Get(Labels{"endpoint": "/api", "status": "200"})
+	assert.True(ok)
+	assert.Equal(100.0, s.Summary.TotalWeight())
+}
+
+func TestFamilyEviction(t *testing.T) {
+	assert := assert.New(t)
+	f, err := NewFamily(0.01, 1000, 2)
+	assert.NoError(err)
+	var evicted []Series
+	f.OnEvict = func(s Series) {
+		evicted = append(evicted, s)
+	}
+
+	a, b, c := Labels{"k": "a"}, Labels{"k": "b"}, Labels{"k": "c"}
+	assert.NoError(f.Push(a, 1, 1))
+	assert.NoError(f.Push(b, 2, 1))
+	// Touch a so b becomes the least recently used series.
+	assert.NoError(f.Push(a, 3, 1))
+	assert.NoError(f.Push(c, 4, 1))
+
+	assert.Equal(2, f.Len())
+	if assert.Equal(1, len(evicted)) {
+		assert.Equal(b, evicted[0].Labels)
+		assert.Equal(2.0, evicted[0].Sum)
+		assert.Equal(1.0, evicted[0].Summary.TotalWeight())
+	}
+	_, ok := f.Get(b)
+	assert.False(ok)
+	_, ok = f.Get(a)
+	assert.True(ok)
+}
+
+func TestFamilyConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	f, err := NewFamily(0.01, 10000, 0)
+	assert.NoError(err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if err := f.Push(Labels{"worker": fmt.Sprint(i % 3)}, float64(i), 1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := 0.0
+	assert.NoError(f.Each(func(s Series) error {
+		total += s.Summary.TotalWeight()
+		return nil
+	}))
+	assert.Equal(4000.0, total)
+}
+
+func TestFamilySeriesSumFollowsPolicy(t *testing.T) {
+	assert := assert.New(t)
+	sketch, err := New(0.01, 1000)
+	assert.NoError(err)
+	sketch.Policy = InputPolicy{NaNValues: DropInput, InfValues: ClampInput, Weights: ClampInput}
+	s := &familySeries{sketch: sketch}
+
+	assert.NoError(s.push(1, 2))
+	assert.NoError(s.push(math.Inf(-1), 1))
+	assert.NoError(s.push(5, -1))
+	assert.NoError(s.push(math.NaN(), 1))
+	view := s.view()
+	assert.Equal(uint64(3), view.Count)
+	assert.Equal(2-math.MaxFloat64, view.Sum)
+}
+
+func TestFamilyPolicy(t *testing.T) {
+	assert := assert.New(t)
+	f, err := NewFamily(0.01, 1000, 1)
+	assert.NoError(err)
+	f.Policy.NaNValues = RejectInput
+
+	assert.NoError(f.Push(Labels{"a": "1"}, 1, 1))
+	assert.True(errors.Is(f.Push(Labels{"a": "1"}, math.NaN(), 1), ErrInvalidInput))
+	assert.NoError(f.Push(Labels{"a": "1"}, 1, -1))
+	assert.Equal(InvalidInputs{Rejected: 1, Dropped: 1}, f.InvalidInputs())
+
+	// A rejected push neither creates a series nor evicts one.
+	assert.True(errors.Is(f.Push(Labels{"a": "3"}, math.NaN(), 1), ErrInvalidInput))
+	assert.Equal(1, f.Len())
+	_, ok := f.Get(Labels{"a": "1"})
+	assert.True(ok)
+	assert.Equal(InvalidInputs{Rejected: 2, Dropped: 1}, f.InvalidInputs())
+
+	// Evicted and deleted series keep counting.
+	assert.NoError(f.Push(Labels{"a": "2"}, 1, -1))
+	assert.Equal(InvalidInputs{Rejected: 2, Dropped: 2}, f.InvalidInputs())
+	assert.True(f.Delete(Labels{"a": "2"}))
+	assert.Equal(InvalidInputs{Rejected: 2, Dropped: 2}, f.InvalidInputs())
+}
@@ -1,11 +1,13 @@
 module github.com/axiomhq/quantiles
 
-go 1.12
+go 1.13
 
 require (
 	github.com/beorn7/perks v1.0.0
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/pkg/errors v0.8.1 // indirect
+	github.com/prometheus/client_golang v1.0.0
+	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90
 	github.com/stretchr/testify v1.3.0
 	github.com/stripe/veneur v12.0.0+incompatible
 )
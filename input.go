@@ -0,0 +1,201 @@
+package quantiles
+
+import (
+	"fmt"
+	"math"
+)
+
+// InputAction is what Sketch.Push does with an invalid input.
+type InputAction int
+
+// Actions ordered by strictness: an input that is invalid in several ways
+// is handled by the strictest applicable action.
+const (
+	// AcceptInput pushes the input as is. Elements with negative or NaN
+	// weights are ignored by the sketch then, NaN values break the ordering
+	// of its summaries and infinite weights their ranks.
+	AcceptInput InputAction = iota
+	// ClampInput clamps infinite values to ±math.MaxFloat64 and negative or
+	// NaN weights to zero. NaN values and infinite weights can't be clamped
+	// and are dropped.
+	ClampInput
+	// DropInput skips the input.
+	DropInput
+	// RejectInput skips the input and returns an error wrapping ErrInvalidInput.
+	RejectInput
+)
+
+func (a InputAction) String() string {
+	switch a {
+	case AcceptInput:
+		return "accept"
+	case ClampInput:
+		return "clamp"
+	case DropInput:
+		return "drop"
+	case RejectInput:
+		return "reject"
+	}
+	return fmt.Sprintf("InputAction(%d)", int(a))
+}
+
+/*
+InputPolicy configures how Sketch.Push handles every kind of invalid input.
+Summaries pushed with PushSummary or Merge can't be dropped or clamped
+partially without breaking the ranks of their other entries, so they are
+rejected as a whole if the policy doesn't accept all of their entries as
+is.
+*/
+type InputPolicy struct {
+	NaNValues InputAction
+	// InfValues applies to values of ±Inf.
+	InfValues InputAction
+	// Weights applies to negative, NaN or infinite weights.
+	Weights InputAction
+}
+
+/*
+defaultInputPolicy keeps infinite values, which summaries represent fine,
+and drops everything else that can't be summarized.
+*/
+var defaultInputPolicy = InputPolicy{
+	NaNValues: DropInput,
+	InfValues: AcceptInput,
+	Weights:   DropInput,
+}
+
+// action returns the action for an input, AcceptInput if the input is valid.
+func (p InputPolicy) action(value, weight float64) InputAction {
+	action := AcceptInput
+	if math.IsNaN(value) {
+		action = p.NaNValues
+		if action == ClampInput {
+			action = DropInput
+		}
+	}
+	if math.IsInf(value, 0) && p.InfValues > action {
+		action = p.InfValues
+	}
+	if !(weight >= 0) || math.IsInf(weight, 1) {
+		weightAction := p.Weights
+		if weightAction == ClampInput && math.IsInf(weight, 1) {
+			weightAction = DropInput
+		}
+		if weightAction > action {
+			action = weightAction
+		}
+	}
+	return action
+}
+
+/*
+Apply returns the action the policy takes for an input, AcceptInput if
+the input is valid, and the element that is pushed for it, which only
+differs from the input if it's clamped. Wrappers use it to keep their own
+aggregates, e.g. sums, consistent with what a sketch pushes.
+*/
+func (p InputPolicy) Apply(value, weight float64) (float64, float64, InputAction) {
+	action := p.action(value, weight)
+	if action == ClampInput {
+		value, weight = p.clamp(value, weight)
+	}
+	return value, weight, action
+}
+
+// invalidInputError returns the error for a rejected input.
+func invalidInputError(value, weight float64) error {
+	return fmt.Errorf("%w: value %v with weight %v", ErrInvalidInput, value, weight)
+}
+
+// clamp clamps the parts of an input the policy says to clamp.
+func (p InputPolicy) clamp(value, weight float64) (float64, float64) {
+	if p.InfValues == ClampInput {
+		switch {
+		case math.IsInf(value, 1):
+			value = math.MaxFloat64
+		case math.IsInf(value, -1):
+			value = -math.MaxFloat64
+		}
+	}
+	if p.Weights == ClampInput && !(weight >= 0) {
+		weight = 0
+	}
+	return value, weight
+}
+
+// InvalidInputs counts the invalid inputs that were not accepted as is.
+type InvalidInputs struct {
+	Rejected uint64 `json:"rejected"`
+	Dropped  uint64 `json:"dropped"`
+	Clamped  uint64 `json:"clamped"`
+	// ZeroWeights counts the elements pushed with a weight of zero,
+	// including clamped ones. They count as elements but carry no weight,
+	// so they don't show up in any summary.
+	ZeroWeights uint64 `json:"zeroWeights"`
+}
+
+func (c *InvalidInputs) add(other InvalidInputs) {
+	c.Rejected += other.Rejected
+	c.Dropped += other.Dropped
+	c.Clamped += other.Clamped
+	c.ZeroWeights += other.ZeroWeights
+}
+
+// accepts reports whether the policy accepts every entry as is.
+func (p InputPolicy) accepts(entries []SumEntry) bool {
+	for _, e := range entries {
+		if p.action(e.value, e.weight) != AcceptInput {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+applyPolicy applies the stream's policy to an input, counting invalid
+ones. It returns the element to push and whether there is one.
+*/
+func (stream *Sketch) applyPolicy(value, weight float64) (float64, float64, bool, error) {
+	pushed, pushedWeight, action := stream.Policy.Apply(value, weight)
+	switch action {
+	case RejectInput:
+		stream.invalid.Rejected++
+		return 0, 0, false, invalidInputError(value, weight)
+	case DropInput:
+		stream.invalid.Dropped++
+		return 0, 0, false, nil
+	case ClampInput:
+		stream.invalid.Clamped++
+	}
+	if pushedWeight == 0 {
+		stream.invalid.ZeroWeights++
+	}
+	return pushed, pushedWeight, true, nil
+}
+
+// rejectedSummaryError returns the error for a summary with entries the policy doesn't accept.
+func rejectedSummaryError() error {
+	return fmt.Errorf("%w: summary with entries the policy doesn't accept", ErrInvalidInput)
+}
+
+// rejectSummary counts a rejected summary and returns the error for it.
+func (stream *Sketch) rejectSummary() error {
+	stream.invalid.Rejected++
+	return rejectedSummaryError()
+}
+
+/*
+decodedPolicy returns the policy of a sketch decoded into the stream: the
+stream's own, unless it's a zero Sketch that was never set up by New.
+*/
+func (stream *Sketch) decodedPolicy() InputPolicy {
+	if stream.buffer == nil && stream.Policy == (InputPolicy{}) {
+		return defaultInputPolicy
+	}
+	return stream.Policy
+}
+
+// InvalidInputs returns the counts of invalid inputs pushed into the stream so far.
+func (stream *Sketch) InvalidInputs() InvalidInputs {
+	return stream.invalid
+}
@@ -0,0 +1,165 @@
+package quantiles
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketchDefaultInputPolicy(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(stream.Push(float64(i), 1))
+		assert.NoError(stream.Push(math.NaN(), 1))
+	}
+	assert.NoError(stream.Push(1, -1))
+	assert.NoError(stream.Push(1, math.NaN()))
+	assert.NoError(stream.Push(1, math.Inf(1)))
+	assert.NoError(stream.Push(math.Inf(1), 1))
+	assert.NoError(stream.Finalize())
+
+	assert.Equal(InvalidInputs{Dropped: 103}, stream.InvalidInputs())
+	sum, err := stream.FinalSummary()
+	assert.NoError(err)
+	assert.NoError(sum.Check(0))
+	assert.Equal(uint64(101), sum.Count())
+	assert.Equal(101.0, sum.TotalWeight())
+	assert.Equal(0.0, sum.MinValue())
+	assert.True(math.IsInf(sum.MaxValue(), 1))
+}
+
+func TestSketchRejectInvalidInputs(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+	stream.Policy = InputPolicy{NaNValues: RejectInput, InfValues: RejectInput, Weights: RejectInput}
+
+	assert.NoError(stream.Push(1, 1))
+	assert.NoError(stream.Push(2, 0))
+	assert.True(errors.Is(stream.Push(math.NaN(), 1), ErrInvalidInput))
+	assert.True(errors.Is(stream.Push(math.Inf(-1), 1), ErrInvalidInput))
+	assert.True(errors.Is(stream.Push(1, -1), ErrInvalidInput))
+	assert.True(errors.Is(stream.Push(1, math.NaN()), ErrInvalidInput))
+	assert.True(errors.Is(stream.Push(1, math.Inf(1)), ErrInvalidInput))
+	// Zero weights are valid, but counted as they don't show up in the summary.
+	assert.Equal(InvalidInputs{Rejected: 5, ZeroWeights: 1}, stream.InvalidInputs())
+
+	assert.NoError(stream.Finalize())
+	sum, err := stream.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(uint64(2), sum.Count())
+	assert.Equal(1.0, sum.TotalWeight())
+}
+
+func TestSketchClampInvalidInputs(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+	stream.Policy = InputPolicy{NaNValues: ClampInput, InfValues: ClampInput, Weights: ClampInput}
+
+	assert.NoError(stream.Push(1, 1))
+	assert.NoError(stream.Push(math.Inf(1), 1))
+	assert.NoError(stream.Push(math.Inf(-1), 2))
+	assert.NoError(stream.Push(3, -1))
+	assert.NoError(stream.Push(math.NaN(), 1))
+	assert.NoError(stream.Push(2, math.Inf(1)))
+	assert.Equal(InvalidInputs{Dropped: 2, Clamped: 3, ZeroWeights: 1}, stream.InvalidInputs())
+
+	assert.NoError(stream.Finalize())
+	sum, err := stream.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(uint64(4), sum.Count())
+	assert.Equal(4.0, sum.TotalWeight())
+	assert.Equal(-math.MaxFloat64, sum.MinValue())
+	assert.Equal(math.MaxFloat64, sum.MaxValue())
+}
+
+func TestInputPolicyAction(t *testing.T) {
+	assert := assert.New(t)
+	p := InputPolicy{NaNValues: DropInput, InfValues: ClampInput, Weights: RejectInput}
+	assert.Equal(AcceptInput, p.action(1, 0))
+	assert.Equal(DropInput, p.action(math.NaN(), 1))
+	assert.Equal(ClampInput, p.action(math.Inf(1), 1))
+	assert.Equal(RejectInput, p.action(math.Inf(1), -1))
+	assert.Equal(RejectInput, p.action(math.NaN(), math.NaN()))
+	assert.Equal(RejectInput, p.action(1, math.Inf(1)))
+	p.Weights = ClampInput
+	assert.Equal(ClampInput, p.action(1, -1))
+	assert.Equal(DropInput, p.action(1, math.Inf(1)))
+	assert.Equal("reject", RejectInput.String())
+}
+
+func TestSketchInvalidInputsMerge(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+	other, err := New(0.01, 1000)
+	assert.NoError(err)
+	other.Policy.InfValues = ClampInput
+	assert.NoError(stream.Push(math.NaN(), 1))
+	assert.NoError(other.Push(math.Inf(1), 1))
+	assert.NoError(other.Push(1, -1))
+
+	assert.NoError(stream.Merge(other))
+	assert.Equal(InvalidInputs{Dropped: 2, Clamped: 1}, stream.InvalidInputs())
+	assert.Equal(other.Policy, other.clone().Policy)
+}
+
+func TestSketchPushSummaryPolicy(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+
+	// Summaries can't be partially dropped, so NaN entries reject them.
+	entries := []SumEntry{
+		{value: 1, weight: 1, minRank: 0, maxRank: 1},
+		{value: math.NaN(), weight: 1, minRank: 1, maxRank: 2},
+	}
+	assert.True(errors.Is(stream.PushSummary(entries), ErrInvalidInput))
+	assert.Equal(InvalidInputs{Rejected: 1}, stream.InvalidInputs())
+	assert.NoError(stream.PushSummary(entries[:1]))
+
+	// Infinite values are accepted by default, unless the policy says otherwise.
+	inf := []SumEntry{{value: math.Inf(1), weight: 1, minRank: 0, maxRank: 1}}
+	assert.NoError(stream.PushSummary(inf))
+	stream.Policy.InfValues = ClampInput
+	assert.True(errors.Is(stream.PushSummary(inf), ErrInvalidInput))
+}
+
+func TestSketchMergePolicy(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+	other, err := New(0.01, 1000)
+	assert.NoError(err)
+	other.Policy = InputPolicy{}
+	assert.NoError(other.Push(1, 1))
+	assert.NoError(other.Push(math.NaN(), 1))
+	assert.NoError(other.Push(math.Inf(1), 1))
+
+	// Rejected elements leave the stream untouched.
+	stream.Policy.NaNValues = RejectInput
+	assert.True(errors.Is(stream.Merge(other), ErrInvalidInput))
+	assert.Equal(uint64(0), stream.n)
+	assert.Equal(int64(0), stream.buffer.curSize)
+
+	// Buffered elements are dropped or clamped like pushed ones.
+	stream.Policy = InputPolicy{NaNValues: DropInput, InfValues: ClampInput}
+	assert.NoError(stream.Merge(other))
+	assert.Equal(uint64(2), stream.n)
+	assert.Equal(InvalidInputs{Rejected: 1, Dropped: 1, Clamped: 1}, stream.InvalidInputs())
+	assert.NoError(stream.Finalize())
+	sum, err := stream.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(math.MaxFloat64, sum.MaxValue())
+
+	// Summaries of other are rejected as a whole.
+	stream, err = New(0.01, 1000)
+	assert.NoError(err)
+	assert.NoError(other.Finalize())
+	assert.True(errors.Is(stream.Merge(other), ErrInvalidInput))
+}
@@ -0,0 +1,9 @@
+// Package ranks holds what the quantiles packages share about comparing ranks.
+package ranks
+
+/*
+Tolerance is the relative tolerance allowed between ranks that should be
+ordered or equal, absorbing the rounding accumulated by merges. It is
+scaled by the total weight of the summary.
+*/
+const Tolerance = 1e-9
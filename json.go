@@ -0,0 +1,203 @@
+package quantiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+/*
+jsonFloat is a float64 that encodes the non-finite values JSON numbers
+can't represent as the strings "+Inf", "-Inf" and "NaN". Infinite values
+are accepted by the default InputPolicy, so summaries can hold them.
+*/
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	switch v := float64(f); {
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+func (f *jsonFloat) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `"+Inf"`:
+		*f = jsonFloat(math.Inf(1))
+		return nil
+	case `"-Inf"`:
+		*f = jsonFloat(math.Inf(-1))
+		return nil
+	case `"NaN"`:
+		*f = jsonFloat(math.NaN())
+		return nil
+	}
+	return json.Unmarshal(data, (*float64)(f))
+}
+
+type jsonEntry struct {
+	Value   jsonFloat `json:"value"`
+	Weight  jsonFloat `json:"weight"`
+	MinRank jsonFloat `json:"minRank"`
+	MaxRank jsonFloat `json:"maxRank"`
+}
+
+type jsonSummary struct {
+	N                  uint64      `json:"n"`
+	ApproximationError jsonFloat   `json:"approximationError"`
+	Entries            []jsonEntry `json:"entries"`
+}
+
+type jsonBufEntry struct {
+	Value  jsonFloat `json:"value"`
+	Weight jsonFloat `json:"weight"`
+}
+
+type jsonSketch struct {
+	Eps          float64        `json:"eps"`
+	BlockSize    int64          `json:"blockSize"`
+	MaxLevels    int64          `json:"maxLevels"`
+	N            uint64         `json:"n"`
+	Finalized    bool           `json:"finalized"`
+	BufferSize   int64          `json:"bufferSize"`
+	Buffer       []jsonBufEntry `json:"buffer"`
+	LocalSummary *jsonSummary   `json:"localSummary"`
+	Levels       []*jsonSummary `json:"levels"`
+	Invalid      *InvalidInputs `json:"invalidInputs,omitempty"`
+}
+
+func (sum *Summary) toJSON() *jsonSummary {
+	js := &jsonSummary{
+		N:                  sum.n,
+		ApproximationError: jsonFloat(sum.ApproximationError()),
+		Entries:            make([]jsonEntry, len(sum.entries)),
+	}
+	for i, e := range sum.entries {
+		js.Entries[i] = jsonEntry{jsonFloat(e.value), jsonFloat(e.weight), jsonFloat(e.minRank), jsonFloat(e.maxRank)}
+	}
+	return js
+}
+
+func (js *jsonSummary) toSummary() (*Summary, error) {
+	if js == nil {
+		return newSummary(), nil
+	}
+	entries := make([]SumEntry, len(js.Entries))
+	for i, e := range js.Entries {
+		entries[i] = SumEntry{float64(e.Value), float64(e.Weight), float64(e.MinRank), float64(e.MaxRank)}
+	}
+	if err := validateEntries(entries); err != nil {
+		return nil, err
+	}
+	return &Summary{entries: entries, n: js.N}, nil
+}
+
+/*
+MarshalJSON implements json.Marshaler.
+Infinite values are encoded as the strings "+Inf" and "-Inf", as JSON
+numbers can't represent them.
+*/
+func (sum *Summary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sum.toJSON())
+}
+
+/*
+UnmarshalJSON implements json.Unmarshaler.
+The entries are checked for rank invariants and an error describing the
+first violation is returned for corrupt input. The approximationError
+field is informational and recomputed from the entries.
+*/
+func (sum *Summary) UnmarshalJSON(data []byte) error {
+	var js jsonSummary
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	tmp, err := js.toSummary()
+	if err != nil {
+		return fmt.Errorf("invalid summary: %v", err)
+	}
+	*sum = *tmp
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (stream *Sketch) MarshalJSON() ([]byte, error) {
+	js := &jsonSketch{
+		Eps:          stream.eps,
+		BlockSize:    stream.blockSize,
+		MaxLevels:    stream.maxLevels,
+		N:            stream.n,
+		Finalized:    stream.finalized,
+		BufferSize:   stream.buffer.maxSize,
+		Buffer:       make([]jsonBufEntry, stream.buffer.curSize),
+		LocalSummary: stream.localSummary.toJSON(),
+		Levels:       make([]*jsonSummary, len(stream.summaryLevels)),
+	}
+	for i, e := range stream.buffer.vec[:stream.buffer.curSize] {
+		js.Buffer[i] = jsonBufEntry{jsonFloat(e.value), jsonFloat(e.weight)}
+	}
+	for i, level := range stream.summaryLevels {
+		js.Levels[i] = level.toJSON()
+	}
+	if stream.invalid != (InvalidInputs{}) {
+		invalid := stream.invalid
+		js.Invalid = &invalid
+	}
+	return json.Marshal(js)
+}
+
+/*
+UnmarshalJSON implements json.Unmarshaler.
+The sketch parameters and every summary are validated, and an error is
+returned for corrupt input. The Policy is kept as with UnmarshalBinary.
+*/
+func (stream *Sketch) UnmarshalJSON(data []byte) error {
+	var js jsonSketch
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	if err := validateSketchSpecs(js.Eps, js.BlockSize, js.MaxLevels, js.BufferSize, int64(len(js.Buffer))); err != nil {
+		return err
+	}
+
+	tmp := &Sketch{
+		eps:       js.Eps,
+		blockSize: js.BlockSize,
+		maxLevels: js.MaxLevels,
+		n:         js.N,
+		finalized: js.Finalized,
+		buffer: &buffer{
+			maxSize: js.BufferSize,
+			curSize: int64(len(js.Buffer)),
+			vec:     make([]bufEntry, js.BufferSize),
+		},
+		summaryLevels: make([]*Summary, len(js.Levels)),
+	}
+	for i, e := range js.Buffer {
+		tmp.buffer.vec[i] = bufEntry{float64(e.Value), float64(e.Weight)}
+		if err := validateBufEntry(i, tmp.buffer.vec[i]); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if tmp.localSummary, err = js.LocalSummary.toSummary(); err != nil {
+		return fmt.Errorf("invalid local summary: %v", err)
+	}
+	for i, level := range js.Levels {
+		if tmp.summaryLevels[i], err = level.toSummary(); err != nil {
+			return fmt.Errorf("invalid summary at level %v: %v", i, err)
+		}
+	}
+	if js.Invalid != nil {
+		tmp.invalid = *js.Invalid
+	}
+	tmp.Policy = stream.decodedPolicy()
+	*stream = *tmp
+	return nil
+}
@@ -0,0 +1,160 @@
+package quantiles
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummaryJSONRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1<<16)
+	assert.NoError(err)
+	totalWeight := 0.0
+	assert.NoError(generateRandUniformRandWeightsSummary(0, 1<<16, &totalWeight, stream))
+	sum, err := stream.FinalSummary()
+	assert.NoError(err)
+
+	data, err := json.Marshal(sum)
+	assert.NoError(err)
+	got := &Summary{}
+	assert.NoError(json.Unmarshal(data, got))
+	assert.Equal(sum.entries, got.entries)
+	assert.Equal(sum.n, got.n)
+	assert.Equal(sum.GenerateQuantiles(10), got.GenerateQuantiles(10))
+}
+
+func TestJSONNonFiniteValues(t *testing.T) {
+	assert := assert.New(t)
+	stream := NewDefault()
+	assert.NoError(stream.Push(math.Inf(-1), 1))
+	assert.NoError(stream.Push(1, 1))
+	assert.NoError(stream.Push(math.Inf(1), 1))
+
+	// Buffered elements.
+	data, err := json.Marshal(stream)
+	assert.NoError(err)
+	assert.Contains(string(data), `{"value":"-Inf","weight":1}`)
+	got := &Sketch{}
+	assert.NoError(json.Unmarshal(data, got))
+	assert.Equal(stream.buffer.vec[:3], got.buffer.vec[:3])
+
+	// Summary entries.
+	assert.NoError(stream.Finalize())
+	sum, err := stream.FinalSummary()
+	assert.NoError(err)
+	data, err = json.Marshal(sum)
+	assert.NoError(err)
+	assert.Contains(string(data), `"value":"+Inf"`)
+	gotSum := &Summary{}
+	assert.NoError(json.Unmarshal(data, gotSum))
+	assert.Equal(sum.entries, gotSum.entries)
+	assert.True(math.IsInf(gotSum.MaxValue(), 1))
+
+	// NaN values are encoded too, but rejected as summary entries.
+	var f jsonFloat
+	assert.NoError(json.Unmarshal([]byte(`"NaN"`), &f))
+	assert.True(math.IsNaN(float64(f)))
+	assert.Error(json.Unmarshal([]byte(`"abc"`), &f))
+	assert.Error(json.Unmarshal([]byte(`{"entries": [{"value": "NaN", "weight": 1, "minRank": 0, "maxRank": 1}]}`), gotSum))
+}
+
+func TestSummaryJSONFields(t *testing.T) {
+	assert := assert.New(t)
+	sum := &Summary{n: 2}
+	sum.buildFromBufferEntries([]bufEntry{{1, 1}, {2, 1}})
+	data, err := json.Marshal(sum)
+	assert.NoError(err)
+	assert.JSONEq(`{
+		"n": 2,
+		"approximationError": 0,
+		"entries": [
+			{"value": 1, "weight": 1, "minRank": 0, "maxRank": 1},
+			{"value": 2, "weight": 1, "minRank": 1, "maxRank": 2}
+		]
+	}`, string(data))
+}
+
+func TestSummaryJSONInvalid(t *testing.T) {
+	for _, input := range []string{
+		`{"entries": [{"value": 2, "weight": 1, "minRank": 0, "maxRank": 1}, {"value": 1, "weight": 1, "minRank": 1, "maxRank": 2}]}`,
+		`{"entries": [{"value": 1, "weight": -1, "minRank": 0, "maxRank": 1}]}`,
+		`{"entries": [{"value": 1, "weight": 1, "minRank": 2, "maxRank": 1}]}`,
+		`{"entries": [{"value": 1, "weight": 1, "minRank": -1, "maxRank": 1}]}`,
+		`{"entries": [{"value": 1, "weight": 1, "minRank": 1, "maxRank": 2}, {"value": 2, "weight": 1, "minRank": 0, "maxRank": 3}]}`,
+		`{"entries": [{"value": 1, "weight": 1, "minRank": 0, "maxRank": 5}, {"value": 2, "weight": 1, "minRank": 1, "maxRank": 2}]}`,
+		`{"entries": "nope"}`,
+	} {
+		sum := &Summary{}
+		assert.Error(t, json.Unmarshal([]byte(input), sum), input)
+	}
+}
+
+func TestSketchJSONRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 10000)
+	assert.NoError(err)
+	for i := 0; i < 5003; i++ {
+		assert.NoError(stream.Push(rand.Float64(), 1))
+	}
+
+	data, err := json.Marshal(stream)
+	assert.NoError(err)
+	got := &Sketch{}
+	assert.NoError(json.Unmarshal(data, got))
+
+	expected, err := stream.MarshalBinary()
+	assert.NoError(err)
+	actual, err := got.MarshalBinary()
+	assert.NoError(err)
+	assert.Equal(expected, actual)
+}
+
+func TestSketchJSONInvalid(t *testing.T) {
+	for _, input := range []string{
+		`{"eps": 0, "blockSize": 10, "maxLevels": 1, "bufferSize": 20}`,
+		`{"eps": 0.1, "blockSize": 10, "maxLevels": 1, "bufferSize": 40}`,
+		`{"eps": 0.1, "blockSize": 1, "maxLevels": 1, "bufferSize": 2, "buffer": [{"value": 1, "weight": 1}, {"value": 1, "weight": 1}]}`,
+		`{"eps": 0.1, "blockSize": 10, "maxLevels": 1, "bufferSize": 20, "buffer": [{"value": 1, "weight": 0}]}`,
+		`{"eps": 0.1, "blockSize": 10, "maxLevels": 1, "bufferSize": 20, "levels": [{"entries": [{"value": 1, "weight": 1, "minRank": 2, "maxRank": 1}]}]}`,
+	} {
+		stream := &Sketch{}
+		assert.Error(t, json.Unmarshal([]byte(input), stream), input)
+	}
+}
+
+func TestValidateSketchEntries(t *testing.T) {
+	// Every summary the sketch produces must pass validation.
+	assert := assert.New(t)
+	stream, err := New(0.01, 1<<16)
+	assert.NoError(err)
+	for i := 0; i < 1<<16; i++ {
+		assert.NoError(stream.Push(rand.NormFloat64(), rand.Float64()))
+		if i%10000 == 0 {
+			for _, level := range stream.summaryLevels {
+				assert.NoError(validateEntries(level.entries))
+			}
+		}
+	}
+	assert.NoError(stream.Finalize())
+	assert.NoError(validateEntries(stream.localSummary.entries))
+}
+
+func TestSketchJSONPolicyAndCounters(t *testing.T) {
+	assert := assert.New(t)
+	stream := NewDefault()
+	assert.NoError(stream.Push(1, 1))
+	assert.NoError(stream.Push(1, -1))
+	data, err := json.Marshal(stream)
+	assert.NoError(err)
+	assert.Contains(string(data), `"invalidInputs":{"rejected":0,"dropped":1,"clamped":0,"zeroWeights":0}`)
+
+	got := NewDefault()
+	got.Policy.Weights = ClampInput
+	assert.NoError(json.Unmarshal(data, got))
+	assert.Equal(ClampInput, got.Policy.Weights)
+	assert.Equal(InvalidInputs{Dropped: 1}, got.InvalidInputs())
+}
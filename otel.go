@@ -0,0 +1,313 @@
+package quantiles
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Scale limits of OTLP exponential histograms.
+const (
+	exponentialMinScale = -10
+	exponentialMaxScale = 20
+)
+
+/*
+HistogramDataPoint mirrors the value fields of an OTLP explicit-bucket
+HistogramDataPoint. BucketCounts has one more element than
+ExplicitBounds: bucket i counts the values in
+(ExplicitBounds[i-1], ExplicitBounds[i]], the last one is unbounded.
+*/
+type HistogramDataPoint struct {
+	Count          uint64
+	Sum            *float64
+	Min            *float64
+	Max            *float64
+	BucketCounts   []uint64
+	ExplicitBounds []float64
+}
+
+// ExponentialHistogramBuckets mirrors the OTLP ExponentialHistogramDataPoint.Buckets.
+type ExponentialHistogramBuckets struct {
+	// Offset is the index of the first bucket in BucketCounts.
+	Offset       int32
+	BucketCounts []uint64
+}
+
+/*
+ExponentialHistogramDataPoint mirrors the value fields of an OTLP
+ExponentialHistogramDataPoint. With base = 2^(2^-Scale), the positive
+bucket with index i counts the values in (base^i, base^(i+1)], the
+negative one the values in [-base^(i+1), -base^i).
+*/
+type ExponentialHistogramDataPoint struct {
+	Count         uint64
+	Sum           *float64
+	Min           *float64
+	Max           *float64
+	Scale         int32
+	ZeroCount     uint64
+	ZeroThreshold float64
+	Positive      ExponentialHistogramBuckets
+	Negative      ExponentialHistogramBuckets
+}
+
+/*
+Histogram converts the summary into an explicit-bucket histogram whose
+bounds are the summary's GenerateBoundaries(numBoundaries). The weight of
+every bucket is estimated from the ranks of its bounds and scaled to
+Count(). Summaries don't track the sum of their values, so Sum is left
+unset.
+*/
+func (sum *Summary) Histogram(numBoundaries int64) (HistogramDataPoint, error) {
+	if numBoundaries < 1 {
+		return HistogramDataPoint{}, fmt.Errorf("%w: numBoundaries should be >= 1, got %v", ErrInvalidArgument, numBoundaries)
+	}
+	if len(sum.entries) == 0 || !(sum.TotalWeight() > 0) {
+		return HistogramDataPoint{BucketCounts: []uint64{0}}, nil
+	}
+
+	var bounds []float64
+	for _, b := range sum.GenerateBoundaries(numBoundaries) {
+		if len(bounds) == 0 || b > bounds[len(bounds)-1] {
+			bounds = append(bounds, b)
+		}
+	}
+	edges := make([]float64, len(bounds)+1)
+	for i, b := range bounds {
+		edges[i] = sum.cumulativeWeight(b)
+	}
+	edges[len(bounds)] = sum.TotalWeight()
+
+	count := sum.histogramCount()
+	minValue, maxValue := sum.MinValue(), sum.MaxValue()
+	return HistogramDataPoint{
+		Count:          count,
+		Min:            &minValue,
+		Max:            &maxValue,
+		BucketCounts:   bucketCounts(edges, sum.TotalWeight(), count),
+		ExplicitBounds: bounds,
+	}, nil
+}
+
+/*
+ExponentialHistogram converts the summary into an exponential histogram
+with at most maxSize positive and maxSize negative buckets, using the
+largest scale that fits. Zero values are counted in the zero bucket.
+The weight of every bucket is estimated from the ranks of its bounds and
+scaled to Count(). Summaries don't track the sum of their values, so Sum
+is left unset. Infinite values can't be represented.
+*/
+func (sum *Summary) ExponentialHistogram(maxSize int32) (ExponentialHistogramDataPoint, error) {
+	// Values just above and below 1 fall into different buckets at every scale.
+	if maxSize < 2 {
+		return ExponentialHistogramDataPoint{}, fmt.Errorf("%w: maxSize should be >= 2, got %v", ErrInvalidArgument, maxSize)
+	}
+	if len(sum.entries) == 0 || !(sum.TotalWeight() > 0) {
+		return ExponentialHistogramDataPoint{Scale: exponentialMaxScale}, nil
+	}
+	minValue, maxValue := sum.MinValue(), sum.MaxValue()
+	if math.IsInf(minValue, 0) || math.IsInf(maxValue, 0) {
+		return ExponentialHistogramDataPoint{}, fmt.Errorf("infinite values can't be represented")
+	}
+
+	// The smallest absolute values of either sign bound the bucket ranges.
+	firstPos := sort.Search(len(sum.entries), func(i int) bool { return sum.entries[i].value > 0 })
+	lastNeg := sort.Search(len(sum.entries), func(i int) bool { return sum.entries[i].value >= 0 }) - 1
+	scale := int32(exponentialMaxScale)
+	for ; scale > exponentialMinScale; scale-- {
+		if (firstPos == len(sum.entries) ||
+			exponentialIndex(maxValue, scale)-exponentialIndex(sum.entries[firstPos].value, scale) < maxSize) &&
+			(lastNeg < 0 ||
+				exponentialIndex(-minValue, scale)-exponentialIndex(-sum.entries[lastNeg].value, scale) < maxSize) {
+			break
+		}
+	}
+
+	// Collect the cumulative weight at the upper edge of every bucket in
+	// ascending order of values: negative buckets, zero, positive buckets.
+	var edges []float64
+	var neg, pos ExponentialHistogramBuckets
+	if lastNeg >= 0 {
+		neg.Offset = exponentialIndex(-sum.entries[lastNeg].value, scale)
+		for i := exponentialIndex(-minValue, scale); i > neg.Offset; i-- {
+			edges = append(edges, sum.cumulativeWeight(math.Nextafter(-exponentialBound(i, scale), math.Inf(-1))))
+		}
+		edges = append(edges, sum.cumulativeWeight(math.Nextafter(0, math.Inf(-1))))
+	}
+	edges = append(edges, sum.cumulativeWeight(0))
+	if firstPos < len(sum.entries) {
+		pos.Offset = exponentialIndex(sum.entries[firstPos].value, scale)
+		for i := pos.Offset; i <= exponentialIndex(maxValue, scale); i++ {
+			edges = append(edges, sum.cumulativeWeight(exponentialBound(i+1, scale)))
+		}
+	}
+	edges[len(edges)-1] = sum.TotalWeight()
+
+	count := sum.histogramCount()
+	counts := bucketCounts(edges, sum.TotalWeight(), count)
+	numNeg := 0
+	if lastNeg >= 0 {
+		numNeg = int(exponentialIndex(-minValue, scale)-neg.Offset) + 1
+		neg.BucketCounts = make([]uint64, numNeg)
+		for i := range neg.BucketCounts {
+			neg.BucketCounts[i] = counts[numNeg-1-i]
+		}
+	}
+	if firstPos < len(sum.entries) {
+		pos.BucketCounts = counts[numNeg+1:]
+	}
+	return ExponentialHistogramDataPoint{
+		Count:     count,
+		Min:       &minValue,
+		Max:       &maxValue,
+		Scale:     scale,
+		ZeroCount: counts[numNeg],
+		Positive:  pos,
+		Negative:  neg,
+	}, nil
+}
+
+/*
+NewSummaryFromHistogram builds a summary from an explicit-bucket
+histogram. Every non-empty bucket is represented by its upper bound at
+the exact rank of the bucket's cumulative count, tightened by Min and
+Max if set, so the width of the buckets shows up as approximation error.
+*/
+func NewSummaryFromHistogram(dp HistogramDataPoint) (*Summary, error) {
+	if len(dp.BucketCounts) != len(dp.ExplicitBounds)+1 {
+		return nil, fmt.Errorf("expected %v bucket counts, got %v", len(dp.ExplicitBounds)+1, len(dp.BucketCounts))
+	}
+	for i, b := range dp.ExplicitBounds {
+		if b != b || i > 0 && !(b > dp.ExplicitBounds[i-1]) {
+			return nil, fmt.Errorf("explicit bounds should be strictly increasing, got %v", dp.ExplicitBounds)
+		}
+	}
+
+	var values []float64
+	for i := range dp.BucketCounts {
+		upper := math.Inf(1)
+		if i < len(dp.ExplicitBounds) {
+			upper = dp.ExplicitBounds[i]
+		}
+		values = append(values, upper)
+	}
+	return summaryFromBuckets(dp.Count, dp.Min, dp.Max, values, dp.BucketCounts)
+}
+
+/*
+NewSummaryFromExponentialHistogram builds a summary from an exponential
+histogram, representing every non-empty bucket by its upper bound like
+NewSummaryFromHistogram.
+*/
+func NewSummaryFromExponentialHistogram(dp ExponentialHistogramDataPoint) (*Summary, error) {
+	if dp.Scale < exponentialMinScale || dp.Scale > exponentialMaxScale {
+		return nil, fmt.Errorf("expected %v <= scale <= %v, got %v", exponentialMinScale, exponentialMaxScale, dp.Scale)
+	}
+	if !(dp.ZeroThreshold >= 0) {
+		return nil, fmt.Errorf("zero threshold should be >= 0, got %v", dp.ZeroThreshold)
+	}
+
+	var values []float64
+	var counts []uint64
+	for i := len(dp.Negative.BucketCounts) - 1; i >= 0; i-- {
+		values = append(values, -exponentialBound(dp.Negative.Offset+int32(i), dp.Scale))
+		counts = append(counts, dp.Negative.BucketCounts[i])
+	}
+	values = append(values, dp.ZeroThreshold)
+	counts = append(counts, dp.ZeroCount)
+	for i, c := range dp.Positive.BucketCounts {
+		values = append(values, exponentialBound(dp.Positive.Offset+int32(i)+1, dp.Scale))
+		counts = append(counts, c)
+	}
+	return summaryFromBuckets(dp.Count, dp.Min, dp.Max, values, counts)
+}
+
+// summaryFromBuckets builds a summary from bucket counts and their ascending upper bounds.
+func summaryFromBuckets(count uint64, minValue, maxValue *float64, uppers []float64, counts []uint64) (*Summary, error) {
+	var total uint64
+	for _, c := range counts {
+		if total+c < total {
+			return nil, fmt.Errorf("bucket counts overflow, expected count %v", count)
+		}
+		total += c
+	}
+	if total != count {
+		return nil, fmt.Errorf("bucket counts add up to %v, expected count %v", total, count)
+	}
+	if count == 0 {
+		return newSummary(), nil
+	}
+
+	points := make(map[float64]float64, len(counts)+1)
+	if minValue != nil {
+		points[0] = *minValue
+	}
+	var cum uint64
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+		cum += c
+		v := uppers[i]
+		if maxValue != nil && *maxValue < v {
+			v = *maxValue
+		}
+		points[float64(cum)/float64(count)] = v
+	}
+	sum := summaryFromQuantiles(points, float64(count))
+	// float64(count) may round up beyond math.MaxUint64.
+	sum.n = count
+	return sum, nil
+}
+
+/*
+cumulativeWeight estimates the weight of the elements less than or equal
+to value, see Rank. Beyond the extreme values of the summary it is exact.
+*/
+func (sum *Summary) cumulativeWeight(value float64) float64 {
+	switch {
+	case value < sum.MinValue():
+		return 0
+	case value >= sum.MaxValue():
+		return sum.TotalWeight()
+	}
+	rank, _, _ := sum.Rank(value)
+	return rank
+}
+
+// histogramCount returns the number of elements to spread over histogram buckets.
+func (sum *Summary) histogramCount() uint64 {
+	if sum.n > 0 {
+		return sum.n
+	}
+	return uint64(math.Round(sum.TotalWeight()))
+}
+
+/*
+bucketCounts converts the cumulative weights at the upper edges of
+consecutive buckets into counts adding up to count.
+*/
+func bucketCounts(edges []float64, totalWeight float64, count uint64) []uint64 {
+	counts := make([]uint64, len(edges))
+	var prev uint64
+	for i, edge := range edges {
+		cum := uint64(math.Round(edge / totalWeight * float64(count)))
+		if cum < prev {
+			cum = prev
+		}
+		counts[i] = cum - prev
+		prev = cum
+	}
+	return counts
+}
+
+// exponentialIndex returns the index of the bucket holding the positive value v.
+func exponentialIndex(v float64, scale int32) int32 {
+	return int32(math.Ceil(math.Ldexp(math.Log2(v), int(scale)))) - 1
+}
+
+// exponentialBound returns the lower bound of the bucket with the given index.
+func exponentialBound(index int32, scale int32) float64 {
+	return math.Exp2(math.Ldexp(float64(index), -int(scale)))
+}
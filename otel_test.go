@@ -0,0 +1,182 @@
+package quantiles
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func otelTestSummary(t *testing.T, values []float64) *Summary {
+	sketch, err := New(0.001, int64(len(values)))
+	assert.NoError(t, err)
+	for _, v := range values {
+		assert.NoError(t, sketch.Push(v, 1))
+	}
+	assert.NoError(t, sketch.Finalize())
+	sum, err := sketch.FinalSummary()
+	assert.NoError(t, err)
+	return sum
+}
+
+func sumCounts(counts []uint64) uint64 {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	return total
+}
+
+func TestSummaryHistogram(t *testing.T) {
+	assert := assert.New(t)
+	values := make([]float64, 10000)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	sum := otelTestSummary(t, values)
+
+	dp, err := sum.Histogram(20)
+	assert.NoError(err)
+	assert.Equal(uint64(10000), dp.Count)
+	assert.Equal(1.0, *dp.Min)
+	assert.Equal(10000.0, *dp.Max)
+	assert.Nil(dp.Sum)
+	assert.Equal(len(dp.ExplicitBounds)+1, len(dp.BucketCounts))
+	assert.Equal(uint64(10000), sumCounts(dp.BucketCounts))
+	assert.Equal(uint64(0), dp.BucketCounts[len(dp.BucketCounts)-1])
+	for i, b := range dp.ExplicitBounds {
+		// Every bucket holds the values in (previous bound, bound].
+		expected := b
+		if i > 0 {
+			expected -= dp.ExplicitBounds[i-1]
+		}
+		assert.InDelta(expected, float64(dp.BucketCounts[i]), 1e-3*10000, "bucket %v", i)
+	}
+
+	back, err := NewSummaryFromHistogram(dp)
+	assert.NoError(err)
+	assert.NoError(back.Check(0))
+	assert.Equal(uint64(10000), back.Count())
+	assert.Equal(10000.0, back.TotalWeight())
+	for _, q := range []float64{0, 0.25, 0.5, 0.9, 1} {
+		v, lower, upper, err := back.QuantileWithBounds(q)
+		assert.NoError(err)
+		assert.True(lower <= 1+q*9999 && 1+q*9999 <= upper, "q = %v: %v not in [%v, %v]", q, 1+q*9999, lower, upper)
+		assert.InDelta(1+q*9999, v, 1000, "q = %v", q)
+	}
+
+	_, err = sum.Histogram(0)
+	assert.Error(err)
+	empty, err := newSummary().Histogram(10)
+	assert.NoError(err)
+	assert.Equal([]uint64{0}, empty.BucketCounts)
+}
+
+func TestSummaryExponentialHistogram(t *testing.T) {
+	assert := assert.New(t)
+	var values []float64
+	for i := 1; i <= 1000; i++ {
+		values = append(values, float64(i), -float64(i)/10)
+	}
+	for i := 0; i < 10; i++ {
+		values = append(values, 0)
+	}
+	sum := otelTestSummary(t, values)
+
+	for _, maxSize := range []int32{160, 20, 2} {
+		dp, err := sum.ExponentialHistogram(maxSize)
+		assert.NoError(err)
+		assert.Equal(uint64(len(values)), dp.Count)
+		assert.True(len(dp.Positive.BucketCounts) <= int(maxSize))
+		assert.True(len(dp.Negative.BucketCounts) <= int(maxSize))
+		assert.Equal(dp.Count, dp.ZeroCount+sumCounts(dp.Positive.BucketCounts)+sumCounts(dp.Negative.BucketCounts))
+		assert.InDelta(10, float64(dp.ZeroCount), 3)
+		assert.InDelta(1000, float64(sumCounts(dp.Positive.BucketCounts)), 3)
+		assert.Equal(-100.0, *dp.Min)
+		assert.Equal(1000.0, *dp.Max)
+
+		back, err := NewSummaryFromExponentialHistogram(dp)
+		assert.NoError(err)
+		assert.NoError(validateEntries(back.entries))
+		assert.Equal(float64(len(values)), back.TotalWeight())
+		assert.Equal(-100.0, back.MinValue())
+		assert.Equal(1000.0, back.MaxValue())
+
+		// Values are reported at the upper bound of their bucket.
+		base := math.Exp2(math.Ldexp(1, -int(dp.Scale)))
+		median, _, _, err := back.QuantileWithBounds(0.75)
+		assert.NoError(err)
+		assert.True(median >= 500*(1-1e-3)/base && median <= 500*(1+1e-3)*base, "scale %v: %v", dp.Scale, median)
+	}
+
+	dp, err := sum.ExponentialHistogram(160)
+	assert.NoError(err)
+	assert.Equal(exponentialIndex(1000, dp.Scale), dp.Positive.Offset+int32(len(dp.Positive.BucketCounts))-1)
+	assert.Equal(exponentialIndex(100, dp.Scale), dp.Negative.Offset+int32(len(dp.Negative.BucketCounts))-1)
+	// The next scale would need more buckets.
+	assert.True(exponentialIndex(1000, dp.Scale+1)-exponentialIndex(1, dp.Scale+1) >= 160)
+
+	_, err = sum.ExponentialHistogram(1)
+	assert.Error(err)
+	_, err = otelTestSummary(t, []float64{1, math.Inf(1)}).ExponentialHistogram(10)
+	assert.Error(err)
+}
+
+func TestExponentialIndex(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int32(-1), exponentialIndex(1, 0))
+	assert.Equal(int32(0), exponentialIndex(1.5, 0))
+	assert.Equal(int32(0), exponentialIndex(2, 0))
+	assert.Equal(int32(1), exponentialIndex(2.5, 0))
+	assert.Equal(int32(3), exponentialIndex(4, 1))
+	assert.Equal(int32(0), exponentialIndex(3, -1))
+	assert.Equal(int32(-1), exponentialIndex(0.5, -1))
+	assert.Equal(4.0, exponentialBound(2, 0))
+	assert.Equal(2.0, exponentialBound(2, 1))
+}
+
+func TestNewSummaryFromHistogramInvalid(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewSummaryFromHistogram(HistogramDataPoint{Count: 1, BucketCounts: []uint64{1, 0}})
+	assert.Error(err)
+	_, err = NewSummaryFromHistogram(HistogramDataPoint{Count: 1, BucketCounts: []uint64{1, 0, 0}, ExplicitBounds: []float64{2, 1}})
+	assert.Error(err)
+	_, err = NewSummaryFromHistogram(HistogramDataPoint{Count: 2, BucketCounts: []uint64{1}})
+	assert.Error(err)
+	_, err = NewSummaryFromExponentialHistogram(ExponentialHistogramDataPoint{Scale: 21})
+	assert.Error(err)
+	_, err = NewSummaryFromHistogram(HistogramDataPoint{Count: 1, BucketCounts: []uint64{math.MaxUint64, 2}, ExplicitBounds: []float64{1}})
+	assert.Error(err)
+
+	sum, err := NewSummaryFromHistogram(HistogramDataPoint{BucketCounts: []uint64{0}})
+	assert.NoError(err)
+	assert.Equal(int64(0), sum.Size())
+
+	// Without Max, values of the overflow bucket are unbounded.
+	sum, err = NewSummaryFromHistogram(HistogramDataPoint{Count: 3, BucketCounts: []uint64{1, 2}, ExplicitBounds: []float64{10}})
+	assert.NoError(err)
+	assert.Equal(10.0, sum.MinValue())
+	assert.True(math.IsInf(sum.MaxValue(), 1))
+}
+
+func TestNewSummaryFromHistogramLargeCount(t *testing.T) {
+	assert := assert.New(t)
+	maxValue := 20.0
+	for _, count := range []uint64{1e9, 1e17, math.MaxUint64} {
+		sum, err := NewSummaryFromHistogram(HistogramDataPoint{
+			Count:          count,
+			BucketCounts:   []uint64{count / 2, count - count/2},
+			ExplicitBounds: []float64{10},
+			Max:            &maxValue,
+		})
+		assert.NoError(err)
+		assert.NoError(sum.Check(0))
+		assert.Equal(count, sum.Count())
+		q, err := sum.Quantile(0.5)
+		assert.NoError(err)
+		assert.Equal(10.0, q)
+		q, err = sum.Quantile(1)
+		assert.NoError(err)
+		assert.Equal(20.0, q)
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Package prom exposes quantile sketches as Prometheus summary metrics.
+
+Summary is a drop-in replacement for prometheus.Summary backed by a
+quantiles.ConcurrentSketch instead of beorn7/perks, and FamilyCollector
+exposes every series of a quantiles.Family. Both emit the configured
+quantile objectives along with _sum and _count.
+*/
+package prom
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/axiomhq/quantiles"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefObjectives are the default quantiles exposed by the collectors.
+var DefObjectives = []float64{0.5, 0.9, 0.99}
+
+// Opts configures the collectors of this package.
+type Opts struct {
+	Namespace   string
+	Subsystem   string
+	Name        string
+	Help        string
+	ConstLabels prometheus.Labels
+
+	// Objectives are the quantiles to expose, DefObjectives is used if empty.
+	Objectives []float64
+
+	// Policy decides how a Summary handles NaN and infinite observations,
+	// the default policy of quantiles.New is used if nil. Observations the
+	// policy drops or rejects don't count towards _sum and _count.
+	Policy *quantiles.InputPolicy
+}
+
+func (opts Opts) objectives() ([]float64, error) {
+	if len(opts.Objectives) == 0 {
+		return DefObjectives, nil
+	}
+	for _, q := range opts.Objectives {
+		if !(q >= 0 && q <= 1) {
+			return nil, fmt.Errorf("%w: expected 0 <= objective <= 1, got %v", quantiles.ErrInvalidQuantile, q)
+		}
+	}
+	objectives := make([]float64, len(opts.Objectives))
+	copy(objectives, opts.Objectives)
+	return objectives, nil
+}
+
+func (opts Opts) desc(labelNames []string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		labelNames,
+		opts.ConstLabels,
+	)
+}
+
+// quantileValues returns the objectives' values of sum, NaN if sum is empty.
+func quantileValues(sum *quantiles.Summary, objectives []float64) map[float64]float64 {
+	values := make(map[float64]float64, len(objectives))
+	for _, q := range objectives {
+		if sum.TotalWeight() <= 0 {
+			values[q] = math.NaN()
+			continue
+		}
+		values[q], _ = sum.Quantile(q)
+	}
+	return values
+}
+
+/*
+Summary is a Prometheus summary metric backed by a ConcurrentSketch.
+It implements prometheus.Collector and prometheus.Observer and covers
+all observations since its creation.
+*/
+type Summary struct {
+	desc       *prometheus.Desc
+	objectives []float64
+	sketch     *quantiles.ConcurrentSketch
+	policy     quantiles.InputPolicy
+
+	mu    sync.Mutex // guards sum and count
+	sum   float64
+	count uint64
+}
+
+// NewSummary returns a new Summary whose sketch has the given eps and maxElements.
+func NewSummary(opts Opts, eps float64, maxElements int64) (*Summary, error) {
+	objectives, err := opts.objectives()
+	if err != nil {
+		return nil, err
+	}
+	sketch, err := quantiles.NewConcurrent(eps, maxElements)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Policy != nil {
+		sketch.Policy = *opts.Policy
+	}
+	return &Summary{
+		desc:       opts.desc(nil),
+		objectives: objectives,
+		sketch:     sketch,
+		policy:     sketch.Policy,
+	}, nil
+}
+
+// Observe adds a single observation to the summary.
+func (s *Summary) Observe(v float64) {
+	if err := s.sketch.Push(v, 1); err != nil {
+		return
+	}
+	// Add up what the sketch pushed, clamped values included.
+	pushed, _, action := s.policy.Apply(v, 1)
+	if action == quantiles.DropInput {
+		return
+	}
+	s.mu.Lock()
+	s.sum += pushed
+	s.count++
+	s.mu.Unlock()
+}
+
+// InvalidInputs returns the counts of invalid observations so far.
+func (s *Summary) InvalidInputs() quantiles.InvalidInputs {
+	return s.sketch.InvalidInputs()
+}
+
+// Describe implements prometheus.Collector.
+func (s *Summary) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.desc
+}
+
+// Collect implements prometheus.Collector.
+func (s *Summary) Collect(ch chan<- prometheus.Metric) {
+	snapshot := s.sketch.Snapshot()
+	s.mu.Lock()
+	sum, count := s.sum, s.count
+	s.mu.Unlock()
+
+	m, err := prometheus.NewConstSummary(s.desc, count, sum, quantileValues(snapshot, s.objectives))
+	if err != nil {
+		m = prometheus.NewInvalidMetric(s.desc, err)
+	}
+	ch <- m
+}
+
+/*
+FamilyCollector exposes the series of a Family as a Prometheus summary
+metric with one label per name in labelNames. Labels missing from a
+series are exposed as empty, series with labels not in labelNames are
+reported as invalid metrics.
+*/
+type FamilyCollector struct {
+	family     *quantiles.Family
+	desc       *prometheus.Desc
+	labelNames []string
+	objectives []float64
+}
+
+// NewFamilyCollector returns a new FamilyCollector for family.
+func NewFamilyCollector(family *quantiles.Family, labelNames []string, opts Opts) (*FamilyCollector, error) {
+	objectives, err := opts.objectives()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(labelNames))
+	copy(names, labelNames)
+	return &FamilyCollector{
+		family:     family,
+		desc:       opts.desc(names),
+		labelNames: names,
+		objectives: objectives,
+	}, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *FamilyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *FamilyCollector) Collect(ch chan<- prometheus.Metric) {
+	c.family.Each(func(s quantiles.Series) error {
+		ch <- c.metric(s)
+		return nil
+	})
+}
+
+func (c *FamilyCollector) metric(s quantiles.Series) prometheus.Metric {
+	values := make([]string, len(c.labelNames))
+	known := 0
+	for i, name := range c.labelNames {
+		if v, ok := s.Labels[name]; ok {
+			values[i] = v
+			known++
+		}
+	}
+	if known != len(s.Labels) {
+		return prometheus.NewInvalidMetric(c.desc,
+			fmt.Errorf("series %v has labels outside of %v", s.Labels, c.labelNames))
+	}
+
+	m, err := prometheus.NewConstSummary(c.desc, s.Count, s.Sum,
+		quantileValues(s.Summary, c.objectives), values...)
+	if err != nil {
+		return prometheus.NewInvalidMetric(c.desc, err)
+	}
+	return m
+}
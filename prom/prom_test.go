@@ -0,0 +1,138 @@
+package prom
+
+import (
+	"math"
+	"testing"
+
+	"github.com/axiomhq/quantiles"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func gather(t *testing.T, c prometheus.Collector) []*dto.MetricFamily {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mfs
+}
+
+func quantileMap(m *dto.Metric) map[float64]float64 {
+	values := map[float64]float64{}
+	for _, q := range m.GetSummary().GetQuantile() {
+		values[q.GetQuantile()] = q.GetValue()
+	}
+	return values
+}
+
+func TestSummary(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewSummary(Opts{Name: "x", Objectives: []float64{1.5}}, 0.01, 1000)
+	assert.Error(err)
+	_, err = NewSummary(Opts{Name: "x"}, 0, 1000)
+	assert.Error(err)
+
+	s, err := NewSummary(Opts{
+		Namespace:   "http",
+		Name:        "request_duration_seconds",
+		Help:        "Request latency.",
+		ConstLabels: prometheus.Labels{"service": "api"},
+	}, 0.001, 100000)
+	assert.NoError(err)
+
+	// No observations yet.
+	mfs := gather(t, s)
+	if assert.Equal(1, len(mfs)) {
+		m := mfs[0].GetMetric()[0]
+		assert.Equal(uint64(0), m.GetSummary().GetSampleCount())
+		assert.True(math.IsNaN(quantileMap(m)[0.5]))
+	}
+
+	for i := 1; i <= 10000; i++ {
+		s.Observe(float64(i) / 1000)
+	}
+	mfs = gather(t, s)
+	if assert.Equal(1, len(mfs)) {
+		mf := mfs[0]
+		assert.Equal("http_request_duration_seconds", mf.GetName())
+		assert.Equal(dto.MetricType_SUMMARY, mf.GetType())
+		m := mf.GetMetric()[0]
+		assert.Equal("service", m.GetLabel()[0].GetName())
+		assert.Equal(uint64(10000), m.GetSummary().GetSampleCount())
+		assert.InDelta(50005, m.GetSummary().GetSampleSum(), 1e-6)
+		values := quantileMap(m)
+		assert.Equal(3, len(values))
+		assert.InDelta(5, values[0.5], 0.02)
+		assert.InDelta(9, values[0.9], 0.02)
+		assert.InDelta(9.9, values[0.99], 0.02)
+	}
+}
+
+func TestSummaryPolicy(t *testing.T) {
+	assert := assert.New(t)
+	s, err := NewSummary(Opts{Name: "x"}, 0.01, 1000)
+	assert.NoError(err)
+	s.Observe(1)
+	s.Observe(math.NaN())
+	assert.Equal(quantiles.InvalidInputs{Dropped: 1}, s.InvalidInputs())
+
+	policy := quantiles.InputPolicy{NaNValues: quantiles.RejectInput, InfValues: quantiles.ClampInput}
+	s, err = NewSummary(Opts{Name: "x", Policy: &policy}, 0.01, 1000)
+	assert.NoError(err)
+	s.Observe(1)
+	s.Observe(math.NaN())
+	s.Observe(math.Inf(-1))
+	assert.Equal(quantiles.InvalidInputs{Rejected: 1, Clamped: 1}, s.InvalidInputs())
+
+	// Only what the sketch pushed counts towards _sum and _count.
+	mfs := gather(t, s)
+	if assert.Equal(1, len(mfs)) {
+		m := mfs[0].GetMetric()[0]
+		assert.Equal(uint64(2), m.GetSummary().GetSampleCount())
+		assert.Equal(1-math.MaxFloat64, m.GetSummary().GetSampleSum())
+	}
+}
+
+func TestFamilyCollector(t *testing.T) {
+	assert := assert.New(t)
+	family, err := quantiles.NewFamily(0.001, 100000, 0)
+	assert.NoError(err)
+	for i := 1; i <= 1000; i++ {
+		assert.NoError(family.Push(quantiles.Labels{"endpoint": "/a", "status": "200"}, float64(i), 1))
+		assert.NoError(family.Push(quantiles.Labels{"endpoint": "/b"}, float64(-i), 1))
+	}
+
+	c, err := NewFamilyCollector(family, []string{"endpoint", "status"}, Opts{
+		Name:       "latency",
+		Help:       "Latency.",
+		Objectives: []float64{0.5},
+	})
+	assert.NoError(err)
+	mfs := gather(t, c)
+	if assert.Equal(1, len(mfs)) {
+		metrics := mfs[0].GetMetric()
+		assert.Equal(2, len(metrics))
+		a, b := metrics[0], metrics[1]
+		assert.Equal("/a", a.GetLabel()[0].GetValue())
+		assert.Equal("200", a.GetLabel()[1].GetValue())
+		assert.Equal(uint64(1000), a.GetSummary().GetSampleCount())
+		assert.Equal(500500.0, a.GetSummary().GetSampleSum())
+		assert.InDelta(500, quantileMap(a)[0.5], 2)
+
+		assert.Equal("/b", b.GetLabel()[0].GetValue())
+		assert.Equal("", b.GetLabel()[1].GetValue())
+		assert.InDelta(-500, quantileMap(b)[0.5], 2)
+	}
+
+	// Series with unknown labels are reported as errors.
+	assert.NoError(family.Push(quantiles.Labels{"region": "eu"}, 1, 1))
+	reg := prometheus.NewRegistry()
+	assert.NoError(reg.Register(c))
+	_, err = reg.Gather()
+	assert.Error(err)
+}
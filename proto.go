@@ -0,0 +1,187 @@
+package quantiles
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Protobuf wire types and field numbers of the messages in proto/quantiles.proto.
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+
+	protoSummaryEntriesField = 1
+
+	protoEntryValueField   = 1
+	protoEntryWeightField  = 2
+	protoEntryMinRankField = 3
+	protoEntryMaxRankField = 4
+)
+
+func appendProtoTag(buf []byte, field, wireType uint64) []byte {
+	return appendProtoVarint(buf, field<<3|wireType)
+}
+
+func appendProtoVarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+func appendProtoFloat(buf []byte, field uint64, v float64) []byte {
+	// proto3 omits fields holding the default value.
+	f := math.Float32bits(float32(v))
+	if f == 0 {
+		return buf
+	}
+	buf = appendProtoTag(buf, field, protoWireFixed32)
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], f)
+	return append(buf, tmp[:]...)
+}
+
+func appendProtoEntry(buf []byte, entry SumEntry) []byte {
+	buf = appendProtoFloat(buf, protoEntryValueField, entry.value)
+	buf = appendProtoFloat(buf, protoEntryWeightField, entry.weight)
+	buf = appendProtoFloat(buf, protoEntryMinRankField, entry.minRank)
+	return appendProtoFloat(buf, protoEntryMaxRankField, entry.maxRank)
+}
+
+// protoField is a single decoded field of a protobuf message.
+type protoField struct {
+	num      uint64
+	wireType uint64
+	varint   uint64
+	fixed32  uint32
+	bytes    []byte
+}
+
+// readProtoField decodes the first field in buf and returns the remaining bytes.
+func readProtoField(buf []byte) (protoField, []byte, error) {
+	var f protoField
+	tag, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return f, nil, fmt.Errorf("invalid protobuf tag")
+	}
+	buf = buf[n:]
+	f.num, f.wireType = tag>>3, tag&7
+	if f.num == 0 {
+		return f, nil, fmt.Errorf("invalid protobuf field number 0")
+	}
+
+	switch f.wireType {
+	case protoWireVarint:
+		if f.varint, n = binary.Uvarint(buf); n <= 0 {
+			return f, nil, fmt.Errorf("invalid protobuf varint in field %v", f.num)
+		}
+		buf = buf[n:]
+	case protoWireFixed64:
+		if len(buf) < 8 {
+			return f, nil, fmt.Errorf("truncated protobuf field %v", f.num)
+		}
+		buf = buf[8:]
+	case protoWireBytes:
+		size, n := binary.Uvarint(buf)
+		if n <= 0 || size > uint64(len(buf)-n) {
+			return f, nil, fmt.Errorf("truncated protobuf field %v", f.num)
+		}
+		f.bytes = buf[n : n+int(size)]
+		buf = buf[n+int(size):]
+	case protoWireFixed32:
+		if len(buf) < 4 {
+			return f, nil, fmt.Errorf("truncated protobuf field %v", f.num)
+		}
+		f.fixed32 = binary.LittleEndian.Uint32(buf)
+		buf = buf[4:]
+	default:
+		return f, nil, fmt.Errorf("unsupported protobuf wire type %v in field %v", f.wireType, f.num)
+	}
+	return f, buf, nil
+}
+
+func readProtoEntry(buf []byte) (SumEntry, error) {
+	var entry SumEntry
+	for len(buf) > 0 {
+		f, rest, err := readProtoField(buf)
+		if err != nil {
+			return entry, err
+		}
+		buf = rest
+
+		var dst *float64
+		switch f.num {
+		case protoEntryValueField:
+			dst = &entry.value
+		case protoEntryWeightField:
+			dst = &entry.weight
+		case protoEntryMinRankField:
+			dst = &entry.minRank
+		case protoEntryMaxRankField:
+			dst = &entry.maxRank
+		default:
+			// Skip unknown fields for forward compatibility.
+			continue
+		}
+		if f.wireType != protoWireFixed32 {
+			return entry, fmt.Errorf("unexpected wire type %v for QuantileEntry field %v", f.wireType, f.num)
+		}
+		*dst = float64(math.Float32frombits(f.fixed32))
+	}
+	return entry, nil
+}
+
+/*
+MarshalProto encodes the summary as a TensorFlow boosted_trees
+QuantileSummaryState message (see proto/quantiles.proto).
+TensorFlow stores entries as 32 bit floats, so values, weights and ranks
+lose precision beyond float32 and the element count isn't preserved.
+*/
+func (sum *Summary) MarshalProto() ([]byte, error) {
+	var (
+		buf   []byte
+		entry []byte
+	)
+	for _, e := range sum.entries {
+		entry = appendProtoEntry(entry[:0], e)
+		buf = appendProtoTag(buf, protoSummaryEntriesField, protoWireBytes)
+		buf = appendProtoVarint(buf, uint64(len(entry)))
+		buf = append(buf, entry...)
+	}
+	return buf, nil
+}
+
+/*
+UnmarshalProto decodes a TensorFlow boosted_trees QuantileSummaryState
+message into the summary. As TensorFlow summaries don't carry an element
+count, the count used by Quantile is derived from the total weight.
+*/
+func (sum *Summary) UnmarshalProto(data []byte) error {
+	entries := []SumEntry{}
+	for len(data) > 0 {
+		f, rest, err := readProtoField(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+		if f.num != protoSummaryEntriesField {
+			continue
+		}
+		if f.wireType != protoWireBytes {
+			return fmt.Errorf("unexpected wire type %v for QuantileSummaryState field %v", f.wireType, f.num)
+		}
+		entry, err := readProtoEntry(f.bytes)
+		if err != nil {
+			return err
+		}
+		if n := len(entries); n > 0 && entry.value < entries[n-1].value {
+			return fmt.Errorf("entry %v is not sorted: %v < %v", n, entry.value, entries[n-1].value)
+		}
+		entries = append(entries, entry)
+	}
+
+	*sum = Summary{entries: entries}
+	sum.n = sum.estimateCount()
+	return nil
+}
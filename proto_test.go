@@ -0,0 +1,88 @@
+package quantiles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummaryProtoWireFormat(t *testing.T) {
+	assert := assert.New(t)
+	sum := &Summary{}
+	sum.buildFromBufferEntries([]bufEntry{{1, 2}})
+
+	// QuantileSummaryState{entries: [{value: 1, weight: 2, min_rank: 0, max_rank: 2}]}
+	expected := []byte{
+		0x0a, 0x0f,
+		0x0d, 0x00, 0x00, 0x80, 0x3f,
+		0x15, 0x00, 0x00, 0x00, 0x40,
+		0x25, 0x00, 0x00, 0x00, 0x40,
+	}
+	data, err := sum.MarshalProto()
+	assert.NoError(err)
+	assert.Equal(expected, data)
+
+	got := &Summary{}
+	assert.NoError(got.UnmarshalProto(expected))
+	assert.Equal(sum.entries, got.entries)
+	assert.Equal(uint64(2), got.n)
+}
+
+func TestSummaryProtoRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	wqsd, err := NewWeightedQuantilesSummaryDummy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := &Summary{}
+	sum.buildFromBufferEntries(wqsd.buffer1.generateEntryList())
+	sum.compress(4, 0)
+
+	data, err := sum.MarshalProto()
+	assert.NoError(err)
+	got := &Summary{}
+	assert.NoError(got.UnmarshalProto(data))
+	assert.Equal(sum.entries, got.entries)
+	assert.Equal(sum.ApproximationError(), got.ApproximationError())
+	assert.Equal(sum.GenerateQuantiles(4), got.GenerateQuantiles(4))
+
+	// The count isn't encoded, fractional weights still yield one.
+	sum = &Summary{entries: []SumEntry{{value: 3, weight: 0.25, maxRank: 0.25}}, n: 1}
+	data, err = sum.MarshalProto()
+	assert.NoError(err)
+	assert.NoError(got.UnmarshalProto(data))
+	assert.Equal(uint64(1), got.n)
+	q, err := got.Quantile(0.5)
+	assert.NoError(err)
+	assert.Equal(3.0, q)
+}
+
+func TestSummaryProtoUnknownFields(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte{
+		0x10, 0x96, 0x01, // unknown varint field 2
+		0x0a, 0x13,
+		0x0d, 0x00, 0x00, 0x80, 0x3f,
+		0x31, 1, 2, 3, 4, 5, 6, 7, 8, // unknown fixed64 field 6
+		0x25, 0x00, 0x00, 0x80, 0x3f,
+	}
+	got := &Summary{}
+	assert.NoError(got.UnmarshalProto(data))
+	assert.Equal([]SumEntry{{value: 1, maxRank: 1}}, got.entries)
+}
+
+func TestSummaryProtoInvalid(t *testing.T) {
+	assert := assert.New(t)
+	got := &Summary{}
+	// Truncated entry.
+	assert.Error(got.UnmarshalProto([]byte{0x0a, 0x05, 0x0d, 0x00}))
+	// Wrong wire type for entries.
+	assert.Error(got.UnmarshalProto([]byte{0x08, 0x01}))
+	// Wrong wire type for value.
+	assert.Error(got.UnmarshalProto([]byte{0x0a, 0x02, 0x08, 0x01}))
+	// Unsorted entries.
+	assert.Error(got.UnmarshalProto([]byte{
+		0x0a, 0x05, 0x0d, 0x00, 0x00, 0x00, 0x40,
+		0x0a, 0x05, 0x0d, 0x00, 0x00, 0x80, 0x3f,
+	}))
+}
@@ -0,0 +1,270 @@
+package quantiles
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// RollupTier configures a tier of a Rollup.
+type RollupTier struct {
+	// Resolution is the length of the tier's buckets. It must be a
+	// multiple of the resolution of the previous tier.
+	Resolution time.Duration
+	// Retention is how long closed buckets are kept, measured from the
+	// start of the newest bucket. Zero keeps buckets forever.
+	Retention time.Duration
+}
+
+// rollupBucket summarizes a single time bucket of a tier.
+type rollupBucket struct {
+	start   time.Time
+	summary *Summary
+	// inputErr bounds the approximation error of the merged summaries.
+	inputErr   float64
+	compressed bool
+}
+
+/*
+err bounds the approximation error of the bucket's summary. Compressing
+only drops entries whose neighbours' ranks are at most eps apart, so
+however often the bucket is compressed, it adds eps once.
+*/
+func (b *rollupBucket) err(eps float64) float64 {
+	if b.compressed {
+		return b.inputErr + eps
+	}
+	return b.inputErr
+}
+
+type rollupTier struct {
+	RollupTier
+	current *rollupBucket
+	closed  []*rollupBucket // sorted by start
+	err     float64
+}
+
+/*
+Rollup downsamples timestamped summaries into tumbling windows of
+increasing resolution, e.g. per-minute summaries into hourly and daily
+ones.
+Summaries added to the rollup are merged into the open bucket of the
+first tier and compressed to about 1/eps entries. A bucket is closed once
+a summary for a later bucket arrives; its summary is then merged into
+the next tier, so the compressions of every tier add to the
+approximation error of the tiers above it. Summaries for closed buckets
+are rejected.
+A Rollup must not be used by multiple goroutines at once.
+*/
+type Rollup struct {
+	// Policy decides which summaries Add accepts: summaries with entries
+	// the policy doesn't accept as is are rejected, see InputPolicy.
+	Policy InputPolicy
+
+	eps     float64
+	tiers   []*rollupTier
+	flushed bool
+	invalid InvalidInputs
+}
+
+/*
+NewRollup returns a new Rollup with the given tiers, ordered from the
+finest to the coarsest resolution. The buckets of every tier are
+compressed with the given eps.
+*/
+func NewRollup(eps float64, tiers ...RollupTier) (*Rollup, error) {
+	if !(eps > 0 && eps < 1) {
+		return nil, fmt.Errorf("%w: eps should be element of (0, 1), got %v", ErrInvalidEpsilon, eps)
+	}
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("%w: at least one tier is required", ErrInvalidArgument)
+	}
+
+	r := &Rollup{
+		Policy: defaultInputPolicy,
+		eps:    eps,
+		tiers:  make([]*rollupTier, len(tiers)),
+	}
+	for i, tier := range tiers {
+		if tier.Resolution <= 0 {
+			return nil, fmt.Errorf("%w: tier %v: resolution should be > 0, got %v", ErrInvalidArgument, i, tier.Resolution)
+		}
+		if tier.Retention < 0 {
+			return nil, fmt.Errorf("%w: tier %v: retention should be >= 0, got %v", ErrInvalidArgument, i, tier.Retention)
+		}
+		if i > 0 && tier.Resolution%tiers[i-1].Resolution != 0 {
+			return nil, fmt.Errorf("%w: tier %v: resolution %v is not a multiple of %v",
+				ErrInvalidArgument, i, tier.Resolution, tiers[i-1].Resolution)
+		}
+		if i > 0 && tier.Resolution == tiers[i-1].Resolution {
+			return nil, fmt.Errorf("%w: tier %v: resolution %v is not coarser than the previous tier", ErrInvalidArgument, i, tier.Resolution)
+		}
+		r.tiers[i] = &rollupTier{RollupTier: tier}
+	}
+	return r, nil
+}
+
+// expire drops closed buckets outside the retention relative to newest.
+func (tier *rollupTier) expire(newest time.Time) {
+	if tier.Retention <= 0 {
+		return
+	}
+	cutoff := newest.Add(-tier.Retention)
+	expired := sort.Search(len(tier.closed), func(i int) bool {
+		return tier.closed[i].start.After(cutoff)
+	})
+	tier.closed = tier.closed[expired:]
+}
+
+/*
+Add merges the summary for time t into the rollup. The summary isn't
+modified or retained. Once the rollup is flushed ErrFinalized is
+returned.
+*/
+func (r *Rollup) Add(t time.Time, sum *Summary) error {
+	if r.flushed {
+		return ErrFinalized
+	}
+	if !r.Policy.accepts(sum.entries) {
+		r.invalid.Rejected++
+		return rejectedSummaryError()
+	}
+	return r.add(0, t, sum, sum.ApproximationError())
+}
+
+// InvalidInputs returns the counts of summaries rejected by the policy.
+func (r *Rollup) InvalidInputs() InvalidInputs {
+	return r.invalid
+}
+
+/*
+add merges a summary whose approximation error is bounded by bound into
+the bucket of the tier containing t. Buckets of higher tiers never
+close before the buckets of lower tiers they cover, so only summaries
+added by the caller can be rejected, before anything is modified.
+*/
+func (r *Rollup) add(level int, t time.Time, sum *Summary, bound float64) error {
+	tier := r.tiers[level]
+	start := t.Truncate(tier.Resolution)
+	if tier.current != nil && start.Before(tier.current.start) ||
+		len(tier.closed) > 0 && !start.After(tier.closed[len(tier.closed)-1].start) {
+		return fmt.Errorf("tier %v: bucket %v is already closed", level, start)
+	}
+
+	if tier.current == nil || start.After(tier.current.start) {
+		if tier.current != nil {
+			if err := r.close(level); err != nil {
+				return err
+			}
+		}
+		tier.current = &rollupBucket{start: start, summary: newSummary()}
+		tier.expire(start)
+	}
+
+	b := tier.current
+	b.summary.Merge(sum)
+	// Merging keeps the largest relative error of its inputs.
+	b.inputErr = maxFloat64(b.inputErr, bound)
+	if b.summary.Size() > int64(math.Ceil(1/r.eps)) {
+		b.summary.Compress(r.eps)
+		b.compressed = true
+	}
+	return nil
+}
+
+// close closes the open bucket of a tier and rolls it into the next tier.
+func (r *Rollup) close(level int) error {
+	tier := r.tiers[level]
+	b := tier.current
+	tier.current = nil
+
+	tier.err = maxFloat64(tier.err, b.err(r.eps))
+	tier.closed = append(tier.closed, b)
+	tier.expire(b.start)
+
+	if level+1 < len(r.tiers) {
+		return r.add(level+1, b.start, b.summary, b.err(r.eps))
+	}
+	return nil
+}
+
+/*
+Flush closes the open bucket of every tier, rolling it into the tiers
+above. Afterwards the rollup only answers queries: closed buckets can't
+be reopened, so Add returns ErrFinalized.
+*/
+func (r *Rollup) Flush() error {
+	if r.flushed {
+		return ErrFinalized
+	}
+	r.flushed = true
+	for level, tier := range r.tiers {
+		if tier.current == nil {
+			continue
+		}
+		if err := r.close(level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rollup) tier(level int) (*rollupTier, error) {
+	if level < 0 || level >= len(r.tiers) {
+		return nil, fmt.Errorf("%w: no tier %v", ErrInvalidLevel, level)
+	}
+	return r.tiers[level], nil
+}
+
+/*
+Summary returns the summary of the tier's bucket containing t. The
+summary of an open bucket only covers what has been rolled into it so far.
+*/
+func (r *Rollup) Summary(level int, t time.Time) (*Summary, error) {
+	tier, err := r.tier(level)
+	if err != nil {
+		return nil, err
+	}
+	start := t.Truncate(tier.Resolution)
+	if b := tier.current; b != nil && b.start.Equal(start) {
+		return b.summary.clone(), nil
+	}
+	idx := sort.Search(len(tier.closed), func(i int) bool {
+		return !tier.closed[i].start.Before(start)
+	})
+	if idx == len(tier.closed) || !tier.closed[idx].start.Equal(start) {
+		return nil, fmt.Errorf("tier %v: no bucket for %v", level, start)
+	}
+	return tier.closed[idx].summary.clone(), nil
+}
+
+// Buckets returns the start times of the tier's retained buckets in ascending order.
+func (r *Rollup) Buckets(level int) ([]time.Time, error) {
+	tier, err := r.tier(level)
+	if err != nil {
+		return nil, err
+	}
+	starts := make([]time.Time, 0, len(tier.closed)+1)
+	for _, b := range tier.closed {
+		starts = append(starts, b.start)
+	}
+	if tier.current != nil {
+		starts = append(starts, tier.current.start)
+	}
+	return starts, nil
+}
+
+/*
+ApproximationError returns a bound on the approximation error of the
+buckets closed so far in the given tier. It accumulates the error of the
+summaries added to the rollup and eps for every tier up to the given one
+that had to compress.
+*/
+func (r *Rollup) ApproximationError(level int) (float64, error) {
+	tier, err := r.tier(level)
+	if err != nil {
+		return 0, err
+	}
+	return tier.err, nil
+}
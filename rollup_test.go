@@ -0,0 +1,147 @@
+package quantiles
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupInvalid(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewRollup(0.01)
+	assert.Error(err)
+	_, err = NewRollup(0, RollupTier{Resolution: time.Hour})
+	assert.Error(err)
+	_, err = NewRollup(math.NaN(), RollupTier{Resolution: time.Hour})
+	assert.Error(err)
+	_, err = NewRollup(0.01, RollupTier{Resolution: 0})
+	assert.Error(err)
+	_, err = NewRollup(0.01, RollupTier{Resolution: time.Hour, Retention: -1})
+	assert.Error(err)
+	_, err = NewRollup(0.01, RollupTier{Resolution: time.Hour}, RollupTier{Resolution: 90 * time.Minute})
+	assert.Error(err)
+	_, err = NewRollup(0.01, RollupTier{Resolution: time.Hour}, RollupTier{Resolution: time.Hour})
+	assert.Error(err)
+}
+
+func minuteSummary(t *testing.T, minute int) *Summary {
+	stream, err := New(0.001, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := stream.Push(float64(minute*100+i), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := stream.FinalSummary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+func TestRollup(t *testing.T) {
+	assert := assert.New(t)
+	eps := 0.01
+	r, err := NewRollup(eps,
+		RollupTier{Resolution: time.Minute, Retention: 30 * time.Minute},
+		RollupTier{Resolution: time.Hour, Retention: 2 * time.Hour},
+		RollupTier{Resolution: 24 * time.Hour},
+	)
+	assert.NoError(err)
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for minute := 0; minute < 5*60; minute++ {
+		at := start.Add(time.Duration(minute)*time.Minute + 30*time.Second)
+		assert.NoError(r.Add(at, minuteSummary(t, minute)))
+	}
+
+	// Retention keeps the newest 30 minutes, including the open one.
+	minutes, err := r.Buckets(0)
+	assert.NoError(err)
+	assert.Equal(30, len(minutes))
+	assert.Equal(start.Add(4*time.Hour+59*time.Minute), minutes[len(minutes)-1])
+
+	// The open hour only holds the closed minutes, the last closed hour is complete.
+	hours, err := r.Buckets(1)
+	assert.NoError(err)
+	assert.Equal([]time.Time{start.Add(3 * time.Hour), start.Add(4 * time.Hour)}, hours)
+	sum, err := r.Summary(1, start.Add(4*time.Hour))
+	assert.NoError(err)
+	assert.Equal(5900.0, sum.TotalWeight())
+	sum, err = r.Summary(1, start.Add(3*time.Hour+10*time.Minute))
+	assert.NoError(err)
+	assert.Equal(6000.0, sum.TotalWeight())
+	assert.Equal(uint64(6000), sum.n)
+	assert.Equal(18000.0, sum.MinValue())
+	assert.Equal(23999.0, sum.MaxValue())
+	q, err := sum.Quantile(0.5)
+	assert.NoError(err)
+	assert.InDelta(21000, q, 6000*eps)
+
+	_, err = r.Summary(1, start)
+	assert.Error(err)
+	_, err = r.Summary(3, start)
+	assert.Error(err)
+
+	// Late data is rejected.
+	assert.Error(r.Add(start.Add(time.Hour), minuteSummary(t, 60)))
+
+	// Rejected summaries leave the rollup untouched.
+	sum, err = r.Summary(1, start.Add(4*time.Hour))
+	assert.NoError(err)
+	assert.Equal(5900.0, sum.TotalWeight())
+
+	assert.NoError(r.Flush())
+	assert.Equal(ErrFinalized, r.Flush())
+	assert.Equal(ErrFinalized, r.Add(start.Add(5*time.Hour), minuteSummary(t, 300)))
+	day, err := r.Summary(2, start)
+	assert.NoError(err)
+	assert.Equal(30000.0, day.TotalWeight())
+	assert.Equal(uint64(30000), day.n)
+	assert.Equal(0.0, day.MinValue())
+	assert.Equal(29999.0, day.MaxValue())
+
+	// The error bounds accumulate over the tiers and hold for the summaries.
+	inputErr := minuteSummary(t, 0).ApproximationError()
+	prev := inputErr
+	for level := 0; level < 3; level++ {
+		approx, err := r.ApproximationError(level)
+		assert.NoError(err)
+		assert.True(approx >= prev, "tier %v: %v < %v", level, approx, prev)
+		assert.True(approx <= inputErr+float64(level+1)*eps, "tier %v: %v", level, approx)
+		prev = approx
+	}
+	approx, err := r.ApproximationError(2)
+	assert.NoError(err)
+	assert.True(day.ApproximationError() <= approx)
+	for i, actual := range day.GenerateQuantiles(10) {
+		assert.InDelta(float64(i)*3000, actual, 30000*eps)
+	}
+}
+
+func TestRollupPolicy(t *testing.T) {
+	assert := assert.New(t)
+	r, err := NewRollup(0.01, RollupTier{Resolution: time.Minute})
+	assert.NoError(err)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	nan := &Summary{entries: []SumEntry{{value: math.NaN(), weight: 1, minRank: 0, maxRank: 1}}, n: 1}
+	assert.True(errors.Is(r.Add(start, nan), ErrInvalidInput))
+	assert.Equal(InvalidInputs{Rejected: 1}, r.InvalidInputs())
+	_, err = r.Buckets(0)
+	assert.NoError(err)
+
+	inf := &Summary{entries: []SumEntry{{value: math.Inf(1), weight: 1, minRank: 0, maxRank: 1}}, n: 1}
+	assert.NoError(r.Add(start, inf))
+	r.Policy.InfValues = RejectInput
+	assert.True(errors.Is(r.Add(start, inf), ErrInvalidInput))
+	assert.Equal(InvalidInputs{Rejected: 2}, r.InvalidInputs())
+}
@@ -5,10 +5,13 @@ import (
 	"math"
 )
 
-var errFinalized = fmt.Errorf("Finalize() already called")
-
 // Sketch ...
 type Sketch struct {
+	// Policy decides how invalid inputs are handled, it must be set before
+	// the sketch is used. New sketches accept infinite values and drop NaN
+	// values and negative, NaN or infinite weights.
+	Policy InputPolicy
+
 	eps           float64
 	maxLevels     int64
 	blockSize     int64
@@ -17,6 +20,7 @@ type Sketch struct {
 	summaryLevels []*Summary
 	finalized     bool
 	n             uint64
+	invalid       InvalidInputs
 }
 
 // NewDefault returns a new Sketch with the eps = 0.01 and maxElements 1000
@@ -27,8 +31,8 @@ func NewDefault() *Sketch {
 
 // New returns a new Sketch for a given eps and maxElements
 func New(eps float64, maxElements int64) (*Sketch, error) {
-	if eps <= 0 {
-		return nil, fmt.Errorf("an epsilon value of zero is not allowed")
+	if !(eps > 0) {
+		return nil, fmt.Errorf("%w: eps should be > 0, got %v", ErrInvalidEpsilon, eps)
 	}
 
 	maxLevels, blockSize, err := getQuantileSpecs(eps, maxElements)
@@ -42,6 +46,7 @@ func New(eps float64, maxElements int64) (*Sketch, error) {
 	}
 
 	stream := &Sketch{
+		Policy:        defaultInputPolicy,
 		eps:           eps,
 		buffer:        buffer,
 		finalized:     false,
@@ -55,13 +60,16 @@ func New(eps float64, maxElements int64) (*Sketch, error) {
 
 func (stream *Sketch) clone() *Sketch {
 	newStream := &Sketch{
+		Policy:        stream.Policy,
 		eps:           stream.eps,
 		buffer:        stream.buffer.clone(),
 		finalized:     stream.finalized,
 		maxLevels:     stream.maxLevels,
 		blockSize:     stream.blockSize,
 		localSummary:  stream.localSummary.clone(),
-		summaryLevels: stream.summaryLevels,
+		summaryLevels: make([]*Summary, len(stream.summaryLevels)),
+		n:             stream.n,
+		invalid:       stream.invalid,
 	}
 	for i, sum := range stream.summaryLevels {
 		newStream.summaryLevels[i] = sum.clone()
@@ -69,51 +77,185 @@ func (stream *Sketch) clone() *Sketch {
 	return newStream
 }
 
-// Push a value and a weight into the stream
+/*
+Snapshot returns the summary of all elements pushed so far without
+finalizing the stream, so it can be queried while pushing continues.
+The sketch isn't modified; the snapshot is what FinalSummary would return
+if Finalize was called now.
+*/
+func (stream *Sketch) Snapshot() *Summary {
+	if stream.finalized {
+		return stream.localSummary.clone()
+	}
+	snapshot := stream.clone()
+	snapshot.Finalize()
+	return snapshot.localSummary
+}
+
+/*
+Push a value and a weight into the stream. Invalid inputs are handled
+according to the stream's Policy.
+*/
 func (stream *Sketch) Push(value float64, weight float64) error {
+	_, _, _, err := stream.push(value, weight)
+	return err
+}
+
+/*
+push pushes an input like Push. It returns the element that was actually
+pushed after applying the policy, and whether there was one.
+*/
+func (stream *Sketch) push(value float64, weight float64) (float64, float64, bool, error) {
 	// Validate state.
-	var err error
 	if stream.finalized {
-		return errFinalized
+		return 0, 0, false, ErrFinalized
+	}
+
+	value, weight, ok, err := stream.applyPolicy(value, weight)
+	if !ok {
+		return 0, 0, false, err
 	}
 
 	if err = stream.buffer.push(value, weight); err != nil {
-		return err
+		return 0, 0, false, err
 	}
 
 	if stream.buffer.isFull() {
 		err = stream.pushBuffer(stream.buffer)
 	}
 	stream.n++
-	return err
+	return value, weight, true, err
 }
 
 func (stream *Sketch) pushBuffer(buf *buffer) error {
 	// Validate state.
 	if stream.finalized {
-		return errFinalized
+		return ErrFinalized
 	}
 	stream.localSummary.buildFromBufferEntries(buf.generateEntryList())
 	stream.localSummary.compress(stream.blockSize, stream.eps)
 	return stream.propagateLocalSummary()
 }
 
-// PushSummary pushes full summary while maintaining approximation error invariants.
+/*
+PushSummary pushes full summary while maintaining approximation error
+invariants. Summaries with entries the stream's Policy doesn't accept as
+is are rejected.
+*/
 func (stream *Sketch) PushSummary(summary []SumEntry) error {
 	// Validate state.
 	if stream.finalized {
-		return errFinalized
+		return ErrFinalized
+	}
+	if !stream.Policy.accepts(summary) {
+		return stream.rejectSummary()
 	}
 	stream.localSummary.buildFromSummaryEntries(summary)
 	stream.localSummary.compress(stream.blockSize, stream.eps)
 	return stream.propagateLocalSummary()
 }
 
+// IncompatibleSketchError is returned when merging sketches with different parameters.
+type IncompatibleSketchError struct {
+	Eps            float64
+	OtherEps       float64
+	BlockSize      int64
+	OtherBlockSize int64
+}
+
+func (e *IncompatibleSketchError) Error() string {
+	return fmt.Sprintf("incompatible sketches: eps %v != %v or block size %v != %v",
+		e.Eps, e.OtherEps, e.BlockSize, e.OtherBlockSize)
+}
+
+// Is reports whether target is ErrIncompatibleSketch.
+func (e *IncompatibleSketchError) Is(target error) bool {
+	return target == ErrIncompatibleSketch
+}
+
+/*
+Merge folds the buffer and summary levels of other into the stream
+while maintaining approximation error invariants: the summary of each
+level of other is propagated from the same level of the stream.
+Both sketches must have been created with the same eps and block size,
+otherwise an *IncompatibleSketchError matching ErrIncompatibleSketch is
+returned. If other is finalized its final summary is pushed as with
+PushSummary. The elements buffered by other are subject to the stream's
+Policy, its summaries are rejected like with PushSummary. Either way
+nothing is merged if anything is rejected. Other isn't modified.
+*/
+func (stream *Sketch) Merge(other *Sketch) error {
+	// Validate state.
+	if stream.finalized {
+		return ErrFinalized
+	}
+	if stream.eps != other.eps || stream.blockSize != other.blockSize {
+		return &IncompatibleSketchError{
+			Eps:            stream.eps,
+			OtherEps:       other.eps,
+			BlockSize:      stream.blockSize,
+			OtherBlockSize: other.blockSize,
+		}
+	}
+
+	// Reject before anything is merged.
+	buffered := other.buffer.vec[:other.buffer.curSize]
+	for _, entry := range buffered {
+		if stream.Policy.action(entry.value, entry.weight) == RejectInput {
+			_, _, _, err := stream.applyPolicy(entry.value, entry.weight)
+			return err
+		}
+	}
+	for _, summary := range append([]*Summary{other.localSummary}, other.summaryLevels...) {
+		if !stream.Policy.accepts(summary.entries) {
+			return stream.rejectSummary()
+		}
+	}
+
+	// Work on a copy so other is left untouched, even if it's the stream itself.
+	other = other.clone()
+	n := other.n
+	for _, entry := range other.buffer.vec[:other.buffer.curSize] {
+		value, weight, ok, _ := stream.applyPolicy(entry.value, entry.weight)
+		if !ok {
+			n--
+			continue
+		}
+		if err := stream.buffer.push(value, weight); err != nil {
+			return err
+		}
+		if stream.buffer.isFull() {
+			if err := stream.pushBuffer(stream.buffer); err != nil {
+				return err
+			}
+		}
+	}
+
+	if other.localSummary.Size() > 0 {
+		stream.localSummary = other.localSummary
+		if err := stream.propagateLocalSummary(); err != nil {
+			return err
+		}
+	}
+	for level, summary := range other.summaryLevels {
+		if summary.Size() == 0 {
+			continue
+		}
+		stream.localSummary = summary
+		if err := stream.propagateLocalSummaryFrom(int64(level)); err != nil {
+			return err
+		}
+	}
+	stream.n += n
+	stream.invalid.add(other.invalid)
+	return nil
+}
+
 // Finalize flushes approximator and finalizes state.
 func (stream *Sketch) Finalize() error {
 	// Validate state.
 	if stream.finalized {
-		return errFinalized
+		return ErrFinalized
 	}
 
 	// Flush any remaining buffer elements.
@@ -131,14 +273,32 @@ func (stream *Sketch) Finalize() error {
 	return nil
 }
 
+// scale multiplies the weights of all elements in the stream by factor.
+func (stream *Sketch) scale(factor float64) {
+	stream.buffer.scale(factor)
+	stream.localSummary.scale(factor)
+	for _, summary := range stream.summaryLevels {
+		summary.scale(factor)
+	}
+}
+
 /*
 propagates local summary through summary levels while maintaining
 approximation error invariants.
 */
 func (stream *Sketch) propagateLocalSummary() error {
+	return stream.propagateLocalSummaryFrom(0)
+}
+
+/*
+propagates local summary through summary levels starting at the given
+level, which must not be higher than the level the local summary's
+approximation error corresponds to.
+*/
+func (stream *Sketch) propagateLocalSummaryFrom(startLevel int64) error {
 	// Validate state.
 	if stream.finalized {
-		return errFinalized
+		return ErrFinalized
 	}
 
 	// No-op if there's nothing to add.
@@ -146,9 +306,9 @@ func (stream *Sketch) propagateLocalSummary() error {
 		return nil
 	}
 
-	for level, settled := int64(0), false; !settled; level++ {
+	for level, settled := startLevel, false; !settled; level++ {
 		// Ensure we have enough depth.
-		if int64(len(stream.summaryLevels)) <= level {
+		for int64(len(stream.summaryLevels)) <= level {
 			stream.summaryLevels = append(stream.summaryLevels, &Summary{})
 		}
 
@@ -175,11 +335,22 @@ func (stream *Sketch) propagateLocalSummary() error {
 // Quantile ...
 func (stream *Sketch) Quantile(q float64) (float64, error) {
 	if !stream.finalized {
-		return 0, fmt.Errorf("Finalize() must be called before generating quantiles")
+		return 0, fmt.Errorf("%w before generating quantiles", ErrNotFinalized)
 	}
 	return stream.localSummary.Quantile(q)
 }
 
+/*
+QuantileWithBounds returns an estimate of the value for quantile q along
+with error bars after finalizing the stream, see Summary.QuantileWithBounds.
+*/
+func (stream *Sketch) QuantileWithBounds(q float64) (value, lower, upper float64, err error) {
+	if !stream.finalized {
+		return 0, 0, 0, fmt.Errorf("%w before generating quantiles", ErrNotFinalized)
+	}
+	return stream.localSummary.QuantileWithBounds(q)
+}
+
 /*
 GenerateQuantiles generates requested number of quantiles after finalizing stream.
 The returned quantiles can be queried using std::lower_bound to get
@@ -187,7 +358,7 @@ the bucket for a given value.
 */
 func (stream *Sketch) GenerateQuantiles(numQuantiles int64) ([]float64, error) {
 	if !stream.finalized {
-		return nil, fmt.Errorf("Finalize() must be called before generating quantiles")
+		return nil, fmt.Errorf("%w before generating quantiles", ErrNotFinalized)
 	}
 	return stream.localSummary.GenerateQuantiles(numQuantiles), nil
 }
@@ -204,7 +375,7 @@ getting a representative sample of boundary values.
 */
 func (stream *Sketch) GenerateBoundaries(numBoundaries int64) ([]float64, error) {
 	if !stream.finalized {
-		return nil, fmt.Errorf("Finalize() must be called before generating quantiles")
+		return nil, fmt.Errorf("%w before generating quantiles", ErrNotFinalized)
 	}
 	return stream.localSummary.GenerateBoundaries(numBoundaries), nil
 }
@@ -218,7 +389,7 @@ error is available.
 func (stream *Sketch) ApproximationError(level int64) (float64, error) {
 	if stream.finalized {
 		if level > 0 {
-			return 0, fmt.Errorf("only overall error is available after Finalize()")
+			return 0, fmt.Errorf("%w: only overall error is available after Finalize()", ErrInvalidLevel)
 		}
 		return stream.localSummary.ApproximationError(), nil
 	}
@@ -235,11 +406,36 @@ func (stream *Sketch) ApproximationError(level int64) (float64, error) {
 		level = int64(len(stream.summaryLevels)) - 1
 	}
 	if level >= int64(len(stream.summaryLevels)) {
-		return 0, fmt.Errorf("invalid level")
+		return 0, fmt.Errorf("%w %v", ErrInvalidLevel, level)
 	}
 	return stream.summaryLevels[level].ApproximationError(), nil
 }
 
+/*
+Rank estimates the total weight of the elements less than or equal to
+value after finalizing the stream, see Summary.Rank.
+*/
+func (stream *Sketch) Rank(value float64) (rank, lower, upper float64, err error) {
+	if !stream.finalized {
+		return 0, 0, 0, fmt.Errorf("%w before computing ranks", ErrNotFinalized)
+	}
+	rank, lower, upper = stream.localSummary.Rank(value)
+	return rank, lower, upper, nil
+}
+
+/*
+CDF estimates the fraction of the total weight held by elements less than
+or equal to value after finalizing the stream, see Summary.CDF.
+The estimate is within ApproximationError(-1) / 2 of the true fraction.
+*/
+func (stream *Sketch) CDF(value float64) (cdf, lower, upper float64, err error) {
+	if !stream.finalized {
+		return 0, 0, 0, fmt.Errorf("%w before computing ranks", ErrNotFinalized)
+	}
+	cdf, lower, upper = stream.localSummary.CDF(value)
+	return cdf, lower, upper, nil
+}
+
 // MaxDepth ...
 func (stream *Sketch) MaxDepth() int {
 	return len(stream.summaryLevels)
@@ -248,7 +444,7 @@ func (stream *Sketch) MaxDepth() int {
 // FinalSummary ...
 func (stream *Sketch) FinalSummary() (*Summary, error) {
 	if !stream.finalized {
-		return nil, fmt.Errorf("Finalize() must be called before generating quantiles")
+		return nil, fmt.Errorf("%w before generating quantiles", ErrNotFinalized)
 	}
 	return stream.localSummary, nil
 }
@@ -263,11 +459,11 @@ func getQuantileSpecs(eps float64, maxElements int64) (int64, int64, error) {
 		maxLevel  int64 = 1
 		blockSize int64 = 2
 	)
-	if eps < 0 || eps >= 1 {
-		return maxLevel, blockSize, fmt.Errorf("eps should be element of [0, 1)")
+	if !(eps >= 0 && eps < 1) {
+		return maxLevel, blockSize, fmt.Errorf("%w: eps should be element of [0, 1), got %v", ErrInvalidEpsilon, eps)
 	}
 	if maxElements <= 0 {
-		return maxLevel, blockSize, fmt.Errorf("maxElements should be > 0")
+		return maxLevel, blockSize, fmt.Errorf("%w: maxElements should be > 0, got %v", ErrInvalidArgument, maxElements)
 	}
 
 	if eps <= math.SmallestNonzeroFloat64 {
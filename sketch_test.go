@@ -16,6 +16,8 @@ func TestInvalidEps(t *testing.T) {
 	assert.Error(err)
 	_, _, err = getQuantileSpecs(1.01, 0)
 	assert.Error(err)
+	_, _, err = getQuantileSpecs(math.NaN(), 1000)
+	assert.Error(err)
 }
 func TestZeroEps(t *testing.T) {
 	assert := assert.New(t)
@@ -364,3 +366,175 @@ func TestSketchMedian(t *testing.T) {
 	}
 
 }
+
+func TestSketchCDF(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1<<16)
+	assert.NoError(err)
+	_, _, _, err = stream.CDF(0.5)
+	assert.Error(err)
+
+	totalWeight := 0.0
+	assert.NoError(generateFixedUniformSummary(0, 1<<16, &totalWeight, stream))
+	eps, err := stream.ApproximationError(-1)
+	assert.NoError(err)
+
+	for _, value := range []float64{-1, 0, 0.1, 0.25, 0.5, 0.99, 2} {
+		exact := math.Min(1, math.Max(0, math.Floor(value*(1<<16))+1)/(1<<16))
+		cdf, lower, upper, err := stream.CDF(value)
+		assert.NoError(err)
+		assert.True(lower <= exact && exact <= upper, "cdf(%v): %v not in [%v, %v]", value, exact, lower, upper)
+		assert.True(math.Abs(cdf-exact) <= eps/2+1e-12, "cdf(%v): |%v - %v| > %v", value, cdf, exact, eps/2)
+
+		rank, _, _, err := stream.Rank(value)
+		assert.NoError(err)
+		assert.InDelta(cdf*totalWeight, rank, 1e-6)
+	}
+}
+
+func TestSketchQuantileWithBounds(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1<<16)
+	assert.NoError(err)
+	_, _, _, err = stream.QuantileWithBounds(0.5)
+	assert.Error(err)
+
+	totalWeight := 0.0
+	assert.NoError(generateFixedUniformSummary(0, 1<<16, &totalWeight, stream))
+	eps, err := stream.ApproximationError(-1)
+	assert.NoError(err)
+
+	for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.9, 0.99, 1} {
+		value, lower, upper, err := stream.QuantileWithBounds(q)
+		assert.NoError(err)
+		exact := math.Min(q, 1-1.0/(1<<16))
+		assert.True(lower <= exact && exact <= upper, "q = %v: %v not in [%v, %v]", q, exact, lower, upper)
+		assert.True(lower <= value && value <= upper, "q = %v: %v not in [%v, %v]", q, value, lower, upper)
+		assert.True(upper-lower <= 4*eps, "q = %v: [%v, %v] wider than %v", q, lower, upper, 4*eps)
+	}
+}
+
+func TestSketchSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1<<16)
+	assert.NoError(err)
+	reference, err := New(0.01, 1<<16)
+	assert.NoError(err)
+
+	for i := 0; i < 1<<16; i++ {
+		x := rand.Float64()
+		assert.NoError(stream.Push(x, 1))
+		assert.NoError(reference.Push(x, 1))
+		if i%10007 != 0 {
+			continue
+		}
+		before, err := stream.MarshalBinary()
+		assert.NoError(err)
+		snapshot := stream.Snapshot()
+		after, err := stream.MarshalBinary()
+		assert.NoError(err)
+		assert.Equal(before, after, "snapshot modified the sketch")
+		assert.Equal(uint64(i+1), snapshot.n)
+		assert.Equal(float64(i+1), snapshot.TotalWeight())
+
+		// The snapshot must match finalizing a copy of the stream.
+		expected := &Sketch{}
+		assert.NoError(expected.UnmarshalBinary(before))
+		assert.NoError(expected.Finalize())
+		final, err := expected.FinalSummary()
+		assert.NoError(err)
+		assert.Equal(final.entries, snapshot.entries)
+	}
+
+	assert.NoError(stream.Finalize())
+	assert.NoError(reference.Finalize())
+	final, err := stream.FinalSummary()
+	assert.NoError(err)
+	expected, err := reference.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(expected.entries, final.entries)
+
+	snapshot := stream.Snapshot()
+	assert.Equal(final.entries, snapshot.entries)
+	snapshot.entries[0].value = -1
+	assert.NotEqual(-1.0, final.entries[0].value)
+}
+
+func TestSketchMerge(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		eps         = 0.01
+		maxElements = int64(1 << 16)
+		numWorkers  = 4
+	)
+	merged, err := New(eps, maxElements)
+	assert.NoError(err)
+	for w := 0; w < numWorkers; w++ {
+		stream, err := New(eps, maxElements)
+		assert.NoError(err)
+		// Interleave the workers' values and leave a partially filled buffer.
+		for i := w; i < int(maxElements)+13; i += numWorkers {
+			assert.NoError(stream.Push(float64(i)/float64(maxElements), 1))
+		}
+		before, err := stream.MarshalBinary()
+		assert.NoError(err)
+		assert.NoError(merged.Merge(stream))
+		after, err := stream.MarshalBinary()
+		assert.NoError(err)
+		assert.Equal(before, after, "merge modified the other sketch")
+	}
+	assert.Equal(uint64(maxElements+13), merged.n)
+
+	assert.NoError(merged.Finalize())
+	approx, err := merged.ApproximationError(-1)
+	assert.NoError(err)
+	assert.True(approx <= eps, "expected %v <= %v", approx, eps)
+	sum, err := merged.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(float64(maxElements+13), sum.TotalWeight())
+	actuals, err := merged.GenerateQuantiles(10)
+	assert.NoError(err)
+	for i, actual := range actuals {
+		assert.InDelta(float64(i)/10, actual, 1e-2)
+	}
+}
+
+func TestSketchMergeSelfAndFinalized(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+	other, err := New(0.01, 1000)
+	assert.NoError(err)
+	for i := 0.0; i < 500; i++ {
+		assert.NoError(stream.Push(i, 1))
+		assert.NoError(other.Push(i+500, 1))
+	}
+	assert.NoError(stream.Merge(stream))
+	assert.NoError(other.Finalize())
+	assert.NoError(stream.Merge(other))
+	assert.NoError(stream.Finalize())
+
+	sum, err := stream.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(1500.0, sum.TotalWeight())
+	assert.Equal(uint64(1500), sum.n)
+	assert.Equal(ErrFinalized, stream.Merge(other))
+}
+
+func TestSketchMergeIncompatible(t *testing.T) {
+	assert := assert.New(t)
+	stream, err := New(0.01, 1000)
+	assert.NoError(err)
+	other, err := New(0.1, 1000)
+	assert.NoError(err)
+
+	err = stream.Merge(other)
+	if incompatible, ok := err.(*IncompatibleSketchError); assert.True(ok) {
+		assert.Equal(0.01, incompatible.Eps)
+		assert.Equal(0.1, incompatible.OtherEps)
+	}
+
+	other, err = New(0.01, 1<<20)
+	assert.NoError(err)
+	assert.Error(stream.Merge(other))
+}
@@ -1,6 +1,12 @@
 package quantiles
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/axiomhq/quantiles/internal/ranks"
+)
 
 // SumEntry represents a summary entry
 type SumEntry struct {
@@ -38,11 +44,28 @@ func (se SumEntry) nextMinRank() float64 {
 	return se.minRank + se.weight
 }
 
+/*
+NewSumEntry returns a summary entry for value with the given weight and
+rank bounds. The weight must be non-negative and the ranks must satisfy
+0 <= minRank <= maxRank - weight.
+*/
+func NewSumEntry(value, weight, minRank, maxRank float64) (SumEntry, error) {
+	se := SumEntry{
+		value:   value,
+		weight:  weight,
+		minRank: minRank,
+		maxRank: maxRank,
+	}
+	if err := se.validate(0); err != nil {
+		return SumEntry{}, err
+	}
+	return se, nil
+}
+
 // Summary is a summarizes the stream entries
 type Summary struct {
-	entries   []SumEntry
-	n         uint64
-	quantiles []float64
+	entries []SumEntry
+	n       uint64
 }
 
 // newSummary ...
@@ -52,9 +75,45 @@ func newSummary() *Summary {
 	}
 }
 
+/*
+NewSummaryFromEntries returns a summary built from entries computed
+elsewhere, e.g. by another implementation of the algorithm.
+The entries must be sorted by value and have non-negative weights and
+monotone ranks. As the number of elements isn't known, the count used
+by Quantile is derived from the total weight, see estimateCount.
+*/
+func NewSummaryFromEntries(entries []SumEntry) (*Summary, error) {
+	if err := validateEntries(entries); err != nil {
+		return nil, err
+	}
+	sum := &Summary{
+		entries: make([]SumEntry, len(entries)),
+	}
+	copy(sum.entries, entries)
+	sum.n = sum.estimateCount()
+	return sum, nil
+}
+
+/*
+estimateCount returns a count for a summary whose number of elements is
+unknown: the total weight rounded up, but at least one element per entry
+and at most math.MaxUint64 elements.
+*/
+func (sum *Summary) estimateCount() uint64 {
+	n := uint64(len(sum.entries))
+	switch total := math.Ceil(sum.TotalWeight()); {
+	case total >= math.MaxUint64:
+		n = math.MaxUint64
+	case total > float64(n):
+		n = uint64(total)
+	}
+	return n
+}
+
 func (sum *Summary) clone() *Summary {
 	newSum := &Summary{
 		entries: make([]SumEntry, len(sum.entries)),
+		n:       sum.n,
 	}
 	for i, entry := range sum.entries {
 		newSum.entries[i] = entry
@@ -81,14 +140,44 @@ func (sum *Summary) buildFromSummaryEntries(ses []SumEntry) {
 	sum.entries = ses
 }
 
-// Merge another summary into the this summary (great for esimating quantiles over several streams)
+// validate checks the invariants of a single entry.
+func (se SumEntry) validate(tol float64) error {
+	if reasons := se.check(tol); len(reasons) > 0 {
+		return fmt.Errorf("%v", reasons[0])
+	}
+	return nil
+}
+
+// rankTolerance absorbs the rounding of ranks accumulated by merges.
+const rankTolerance = ranks.Tolerance
+
+/*
+validateEntries checks the rank invariants of a list of summary entries:
+values sorted, non-negative weights, minRank + weight <= maxRank and
+monotone ranks. Summaries violating them produce meaningless quantiles.
+*/
+func validateEntries(entries []SumEntry) error {
+	if violations := checkEntries(entries); len(violations) > 0 {
+		return violations[0]
+	}
+	return nil
+}
+
+/*
+Merge another summary into the this summary (great for esimating quantiles over several streams).
+The element counts of both summaries are added up, so Count covers the
+elements of both. The summary never shares entries with other, even when
+it was empty before, so either can be compressed or scaled afterwards
+without affecting the other.
+*/
 func (sum *Summary) Merge(other *Summary) {
+	sum.n += other.n
 	otherEntries := other.entries
 	if len(otherEntries) == 0 {
 		return
 	}
 	if len(sum.entries) == 0 {
-		sum.entries = otherEntries
+		sum.entries = append([]SumEntry(nil), otherEntries...)
 		return
 	}
 
@@ -214,7 +303,32 @@ func (sum *Summary) compress(sizeHint int64, minEps float64) {
 	sum.entries = sum.entries[:wi]
 }
 
-// GenerateBoundaries ...
+// scale multiplies the weights and ranks of all entries by factor.
+func (sum *Summary) scale(factor float64) {
+	for i := range sum.entries {
+		sum.entries[i].weight *= factor
+		sum.entries[i].minRank *= factor
+		sum.entries[i].maxRank *= factor
+	}
+}
+
+/*
+Compress reduces the summary to about 1/eps entries, e.g. after merging
+many summaries, increasing its approximation error by at most eps.
+*/
+func (sum *Summary) Compress(eps float64) error {
+	if !(eps > 0) {
+		return fmt.Errorf("%w: eps should be > 0, got %v", ErrInvalidEpsilon, eps)
+	}
+	sum.compress(int64(math.Ceil(1/eps)), eps)
+	return nil
+}
+
+/*
+GenerateBoundaries returns at least numBoundaries values of the summary
+in ascending order, see Sketch.GenerateBoundaries. The summary itself
+isn't modified.
+*/
 func (sum *Summary) GenerateBoundaries(numBoundaries int64) []float64 {
 	// To construct the boundaries we first run a soft compress over a copy
 	// of the summary and retrieve the values.
@@ -225,8 +339,7 @@ func (sum *Summary) GenerateBoundaries(numBoundaries int64) []float64 {
 	}
 
 	// Generate soft compressed summary.
-	compressedSummary := &Summary{}
-	compressedSummary.buildFromSummaryEntries(sum.entries)
+	compressedSummary := sum.clone()
 	// Set an epsilon for compression that's at most 1.0 / num_boundaries
 	// more than epsilon of original our summary since the compression operation
 	// adds ~1.0/num_boundaries to final approximation error.
@@ -234,31 +347,77 @@ func (sum *Summary) GenerateBoundaries(numBoundaries int64) []float64 {
 	compressedSummary.compress(numBoundaries, compressionEps)
 
 	// Return boundaries.
-	output := make([]float64, len(compressedSummary.entries))
+	output := make([]float64, 0, len(compressedSummary.entries))
 	for _, entry := range compressedSummary.entries {
 		output = append(output, entry.value)
 	}
 	return output
 }
 
-// Quantile returns the value for quantile q
+/*
+Quantile returns the value for quantile q. It binary searches the entries
+for the rank q * TotalWeight(), so its cost doesn't depend on the number
+of summarized elements.
+*/
 func (sum *Summary) Quantile(q float64) (float64, error) {
-	// To construct the desired n-quantiles we repetitively query n ranks from the
-	// original summary. The following algorithm is an efficient cache-friendly
-	// O(n) implementation of that idea which avoids the cost of the repetitive
-	// full rank queries O(nlogn).
 	if q < 0 || q > 1 {
-		return 0, fmt.Errorf("expected 0 <= q <= 1, got q = %v", q)
+		return 0, fmt.Errorf("%w: expected 0 <= q <= 1, got q = %v", ErrInvalidQuantile, q)
 	}
-	numQuantiles := int64(sum.n)
-	if numQuantiles == 0 {
+	if len(sum.entries) == 0 {
 		return 0, nil
 	}
-	if len(sum.quantiles) == 0 {
-		sum.quantiles = sum.GenerateQuantiles(numQuantiles + 1)
+	return sum.entries[sum.estimateIndex(q*sum.TotalWeight())].value, nil
+}
+
+// estimateIndex returns the index of the entry GenerateQuantiles picks for rank.
+func (sum *Summary) estimateIndex(rank float64) int {
+	d2 := 2 * rank
+	nextIdx := 1 + sort.Search(len(sum.entries)-1, func(i int) bool {
+		return d2 < sum.entries[i+1].minRank+sum.entries[i+1].maxRank
+	})
+	curIdx := nextIdx - 1
+	if nextIdx == len(sum.entries) || d2 < sum.entries[curIdx].nextMinRank()+sum.entries[nextIdx].prevMaxRank() {
+		return curIdx
+	}
+	return nextIdx
+}
+
+/*
+QuantileWithBounds returns an estimate of the value for quantile q along
+with the smallest and largest values of the summary whose rank interval
+[minRank, maxRank] lies within ApproximationError() * TotalWeight() of
+the target rank q * TotalWeight(). The true quantile is guaranteed to lie
+in [lower, upper].
+*/
+func (sum *Summary) QuantileWithBounds(q float64) (value, lower, upper float64, err error) {
+	if q < 0 || q > 1 {
+		return 0, 0, 0, fmt.Errorf("%w: expected 0 <= q <= 1, got q = %v", ErrInvalidQuantile, q)
+	}
+	if len(sum.entries) == 0 {
+		return 0, 0, 0, nil
+	}
+
+	totalWeight := sum.TotalWeight()
+	rank := q * totalWeight
+	slack := sum.ApproximationError() * totalWeight
+
+	value = sum.entries[sum.estimateIndex(rank)].value
+
+	lowerIdx := sort.Search(len(sum.entries), func(i int) bool {
+		return sum.entries[i].maxRank >= rank-slack
+	})
+	if lowerIdx == len(sum.entries) {
+		lowerIdx--
+	}
+	upperIdx := sort.Search(len(sum.entries), func(i int) bool {
+		return sum.entries[i].minRank > rank+slack
+	}) - 1
+	if upperIdx < 0 {
+		upperIdx = 0
 	}
-	qIdx := int(float64(numQuantiles)*q + 0.5)
-	return sum.quantiles[qIdx], nil
+	lower = minFloat64(value, sum.entries[lowerIdx].value)
+	upper = maxFloat64(value, sum.entries[upperIdx].value)
+	return value, lower, upper, nil
 }
 
 // GenerateQuantiles returns a slice of float64 of size numQuantiles+1, the ith entry is the `i * 1/numQuantiles+1` quantile
@@ -311,6 +470,48 @@ func (sum *Summary) ApproximationError() float64 {
 	return maxGap / sum.TotalWeight()
 }
 
+/*
+Rank estimates the total weight of the elements less than or equal to
+value. Besides the estimate it returns the lower and upper bounds on that
+weight derived from the rank bounds of the neighbouring entries.
+The bounds are at most ApproximationError() * TotalWeight() apart and the
+estimate lies in the middle of them.
+*/
+func (sum *Summary) Rank(value float64) (rank, lower, upper float64) {
+	if len(sum.entries) == 0 {
+		return 0, 0, 0
+	}
+	// Find the first entry greater than value.
+	idx := sort.Search(len(sum.entries), func(i int) bool {
+		return sum.entries[i].value > value
+	})
+	if idx > 0 {
+		lower = sum.entries[idx-1].nextMinRank()
+	}
+	if idx < len(sum.entries) {
+		upper = sum.entries[idx].prevMaxRank()
+	} else {
+		upper = sum.TotalWeight()
+	}
+	upper = maxFloat64(lower, upper)
+	return (lower + upper) / 2, lower, upper
+}
+
+/*
+CDF estimates the fraction of the total weight held by elements less than
+or equal to value, i.e. Rank normalized by TotalWeight.
+The estimate is within ApproximationError() / 2 of the true fraction,
+which lies between the returned lower and upper bounds.
+*/
+func (sum *Summary) CDF(value float64) (cdf, lower, upper float64) {
+	totalWeight := sum.TotalWeight()
+	if totalWeight <= 0 {
+		return 0, 0, 0
+	}
+	rank, lower, upper := sum.Rank(value)
+	return rank / totalWeight, lower / totalWeight, upper / totalWeight
+}
+
 // MinValue returns the min weight value of the summary
 func (sum *Summary) MinValue() float64 {
 	if len(sum.entries) != 0 {
@@ -335,14 +536,20 @@ func (sum *Summary) TotalWeight() float64 {
 	return 0
 }
 
+// Count returns the number of elements summarized
+func (sum *Summary) Count() uint64 {
+	return sum.n
+}
+
 // Size returns the size (num of entries) in the summary
 func (sum *Summary) Size() int64 {
 	return int64(len(sum.entries))
 }
 
-// Clear reset the summary
+// Clear resets the entries and the element count of the summary.
 func (sum *Summary) Clear() {
 	sum.entries = []SumEntry{}
+	sum.n = 0
 }
 
 // Entries returns all summary entries
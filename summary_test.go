@@ -1,6 +1,7 @@
 package quantiles
 
 import (
+	"math"
 	"math/rand"
 	"testing"
 
@@ -335,3 +336,271 @@ func TestSummaryCompressThenMerge(t *testing.T) {
 	assert.Equal(sum1.TotalWeight(),
 		wqsd.buffer1TotalWeight+wqsd.buffer2TotalWeight)
 }
+
+func TestNewSumEntry(t *testing.T) {
+	assert := assert.New(t)
+	se, err := NewSumEntry(3, 2, 1, 4)
+	assert.NoError(err)
+	assert.Equal(3.0, se.Value())
+	assert.Equal(2.0, se.Weight())
+	assert.Equal(1.0, se.MinRank())
+	assert.Equal(4.0, se.MaxRank())
+
+	for _, args := range [][4]float64{
+		{3, -1, 1, 4},
+		{3, 2, -1, 4},
+		{3, 2, 3, 4},
+		{math.NaN(), 2, 1, 4},
+		{3, math.NaN(), 1, 4},
+	} {
+		_, err := NewSumEntry(args[0], args[1], args[2], args[3])
+		assert.Error(err, "%v", args)
+	}
+}
+
+func TestNewSummaryFromEntries(t *testing.T) {
+	assert := assert.New(t)
+	wqsd, err := NewWeightedQuantilesSummaryDummy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Summary{}
+	expected.buildFromBufferEntries(wqsd.buffer1.generateEntryList())
+	expected.compress(6, 0)
+
+	entries := []SumEntry{}
+	for _, e := range expected.Entries() {
+		se, err := NewSumEntry(e.Value(), e.Weight(), e.MinRank(), e.MaxRank())
+		assert.NoError(err)
+		entries = append(entries, se)
+	}
+	sum, err := NewSummaryFromEntries(entries)
+	assert.NoError(err)
+	assert.Equal(expected.entries, sum.entries)
+	assert.Equal(uint64(wqsd.buffer1TotalWeight), sum.n)
+	assert.Equal(expected.GenerateQuantiles(4), sum.GenerateQuantiles(4))
+
+	// The summary doesn't alias the caller's entries.
+	entries[0].value = 100
+	assert.Equal(wqsd.buffer1MinValue, sum.MinValue())
+
+	// External summaries can be pushed into a sketch.
+	stream, err := New(0.1, 100)
+	assert.NoError(err)
+	assert.NoError(stream.PushSummary(sum.Entries()))
+	assert.NoError(stream.Finalize())
+	final, err := stream.FinalSummary()
+	assert.NoError(err)
+	assert.Equal(wqsd.buffer1TotalWeight, final.TotalWeight())
+
+	// Fractional weights still count at least one element per entry.
+	sum, err = NewSummaryFromEntries([]SumEntry{
+		{value: 1, weight: 0.1, minRank: 0, maxRank: 0.1},
+		{value: 2, weight: 0.2, minRank: 0.1, maxRank: 0.3},
+	})
+	assert.NoError(err)
+	assert.Equal(uint64(2), sum.n)
+	assert.NoError(sum.Check(0))
+	q, err := sum.Quantile(1)
+	assert.NoError(err)
+	assert.Equal(2.0, q)
+
+	// Huge weights cap the count, Quantile doesn't depend on it.
+	sum, err = NewSummaryFromEntries([]SumEntry{{value: 1, weight: 1e300, maxRank: 1e300}})
+	assert.NoError(err)
+	assert.Equal(uint64(math.MaxUint64), sum.Count())
+	q, err = sum.Quantile(0.5)
+	assert.NoError(err)
+	assert.Equal(1.0, q)
+}
+
+func TestNewSummaryFromEntriesInvalid(t *testing.T) {
+	assert := assert.New(t)
+	entry := func(value, weight, minRank, maxRank float64) SumEntry {
+		se, err := NewSumEntry(value, weight, minRank, maxRank)
+		assert.NoError(err)
+		return se
+	}
+
+	// Unsorted values.
+	_, err := NewSummaryFromEntries([]SumEntry{entry(2, 1, 0, 1), entry(1, 1, 1, 2)})
+	assert.Error(err)
+	// Decreasing minRank.
+	_, err = NewSummaryFromEntries([]SumEntry{entry(1, 1, 1, 2), entry(2, 1, 0, 3)})
+	assert.Error(err)
+	// Decreasing maxRank.
+	_, err = NewSummaryFromEntries([]SumEntry{entry(1, 1, 0, 5), entry(2, 1, 1, 2)})
+	assert.Error(err)
+	// Zero value entries.
+	_, err = NewSummaryFromEntries([]SumEntry{{}, {value: 1, weight: -1}})
+	assert.Error(err)
+
+	sum, err := NewSummaryFromEntries(nil)
+	assert.NoError(err)
+	assert.Equal(int64(0), sum.Size())
+}
+
+func TestSummaryRank(t *testing.T) {
+	assert := assert.New(t)
+	wqsd, err := NewWeightedQuantilesSummaryDummy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := &Summary{}
+	sum.buildFromBufferEntries(wqsd.buffer1.generateEntryList())
+
+	// Without compression ranks are exact.
+	for value, expected := range map[float64]float64{
+		-20: 0, -13: 4, -1: 21, 0: 21, 4: 26, 21: 45, 100: 45,
+	} {
+		rank, lower, upper := sum.Rank(value)
+		assert.Equal(expected, rank, "rank(%v)", value)
+		assert.Equal(expected, lower, "rank(%v)", value)
+		assert.Equal(expected, upper, "rank(%v)", value)
+	}
+	cdf, lower, upper := sum.CDF(-1)
+	assert.Equal(21.0/45, cdf)
+	assert.Equal(cdf, lower)
+	assert.Equal(cdf, upper)
+
+	// Compressed summaries bound the exact ranks.
+	sum.compress(4, 0)
+	maxGap := sum.ApproximationError() * sum.TotalWeight()
+	for value, expected := range map[float64]float64{
+		-13: 4, -5: 11, -1: 21, 2: 24, 5: 35, 8: 37,
+	} {
+		rank, lower, upper := sum.Rank(value)
+		assert.True(lower <= expected && expected <= upper, "rank(%v): %v not in [%v, %v]", value, expected, lower, upper)
+		assert.True(upper-lower <= maxGap, "rank(%v): [%v, %v] wider than %v", value, lower, upper, maxGap)
+		assert.Equal((lower+upper)/2, rank)
+	}
+
+	empty := &Summary{}
+	cdf, lower, upper = empty.CDF(1)
+	assert.Equal([]float64{0, 0, 0}, []float64{cdf, lower, upper})
+}
+
+func TestSummaryQuantileWithBounds(t *testing.T) {
+	assert := assert.New(t)
+	wqsd, err := NewWeightedQuantilesSummaryDummy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := &Summary{}
+	sum.buildFromBufferEntries(wqsd.buffer1.generateEntryList())
+
+	// Without compression there is no uncertainty.
+	value, lower, upper, err := sum.QuantileWithBounds(0.5)
+	assert.NoError(err)
+	assert.Equal([]float64{2, 2, 2}, []float64{value, lower, upper})
+
+	for _, q := range []float64{0, 0.1, 0.3, 0.7, 1} {
+		value, _, _, err := sum.QuantileWithBounds(q)
+		assert.NoError(err)
+		assert.Equal(sum.GenerateQuantiles(10)[int(q*10)], value, "q = %v", q)
+	}
+
+	sum.compress(4, 0)
+	value, lower, upper, err = sum.QuantileWithBounds(0.5)
+	assert.NoError(err)
+	assert.True(lower <= 2 && 2 <= upper, "2 not in [%v, %v]", lower, upper)
+	assert.True(lower <= value && value <= upper, "%v not in [%v, %v]", value, lower, upper)
+
+	_, _, _, err = sum.QuantileWithBounds(1.1)
+	assert.Error(err)
+	_, _, _, err = sum.QuantileWithBounds(-0.1)
+	assert.Error(err)
+}
+
+func TestSummaryMergeCountAndCompress(t *testing.T) {
+	assert := assert.New(t)
+	entries := make([]bufEntry, 1000)
+	for i := range entries {
+		entries[i] = bufEntry{float64(i), 1}
+	}
+	sum1 := &Summary{n: 500}
+	sum1.buildFromBufferEntries(entries[:500])
+	sum2 := &Summary{n: 500}
+	sum2.buildFromBufferEntries(entries[500:])
+
+	merged := &Summary{}
+	merged.Merge(sum1)
+	merged.Merge(sum2)
+	assert.Equal(uint64(1000), merged.Count())
+	assert.Equal(1000.0, merged.TotalWeight())
+
+	assert.Error(merged.Compress(0))
+	assert.NoError(merged.Compress(0.01))
+	assert.True(merged.Size() <= 102)
+	assert.True(merged.ApproximationError() <= 0.01)
+	median, err := merged.Quantile(0.5)
+	assert.NoError(err)
+	assert.InDelta(500, median, 10)
+	// Compressing the merged summary leaves the inputs untouched.
+	assert.Equal(int64(500), sum1.Size())
+}
+
+func TestSummaryMerge(t *testing.T) {
+	assert := assert.New(t)
+	entries := make([]bufEntry, 100)
+	for i := range entries {
+		entries[i] = bufEntry{float64(i), 1}
+	}
+	other := &Summary{n: 50}
+	other.buildFromBufferEntries(entries[:50])
+
+	// Merging into an empty summary copies the entries of other.
+	sum := newSummary()
+	sum.Merge(other)
+	assert.Equal(uint64(50), sum.Count())
+	sum.scale(2)
+	assert.Equal(50.0, other.TotalWeight())
+
+	// Quantile answers from the merged entries.
+	sum = newSummary()
+	sum.Merge(other)
+	median, err := sum.Quantile(0.5)
+	assert.NoError(err)
+	assert.Equal(25.0, median)
+	more := &Summary{n: 50}
+	more.buildFromBufferEntries(entries[50:])
+	sum.Merge(more)
+	assert.Equal(uint64(100), sum.Count())
+	median, err = sum.Quantile(0.5)
+	assert.NoError(err)
+	assert.Equal(50.0, median)
+
+	// Neither input is modified through the merged summary.
+	assert.NoError(sum.Compress(0.1))
+	assert.Equal(int64(50), other.Size())
+	assert.Equal(int64(50), more.Size())
+	assert.Equal(uint64(50), other.Count())
+
+	sum.Clear()
+	assert.Equal(uint64(0), sum.Count())
+	assert.Equal(int64(0), sum.Size())
+}
+
+func TestSummaryGenerateBoundaries(t *testing.T) {
+	assert := assert.New(t)
+	entries := make([]bufEntry, 1000)
+	for i := range entries {
+		entries[i] = bufEntry{float64(i + 1), 1}
+	}
+	sum := newSummary()
+	sum.buildFromBufferEntries(entries)
+	sum.compress(100, 0.01)
+	before := append([]SumEntry(nil), sum.Entries()...)
+
+	// The boundaries are strictly increasing values of the summary, without
+	// leading zeros, and the summary itself is left untouched.
+	boundaries := sum.GenerateBoundaries(10)
+	assert.True(len(boundaries) >= 10)
+	assert.Equal(1.0, boundaries[0])
+	assert.Equal(1000.0, boundaries[len(boundaries)-1])
+	for i := 1; i < len(boundaries); i++ {
+		assert.True(boundaries[i] > boundaries[i-1])
+	}
+	assert.Equal(before, sum.Entries())
+	assert.Equal([]float64{}, newSummary().GenerateBoundaries(10))
+}
@@ -0,0 +1,159 @@
+package quantiles
+
+import (
+	"fmt"
+	"time"
+)
+
+// windowedBucket holds the sketch of a single interval.
+type windowedBucket struct {
+	start  time.Time
+	sketch *Sketch
+}
+
+/*
+WindowedSketch answers quantile queries over a trailing time window.
+It keeps a ring of per-interval sketches; elements are pushed into the
+sketch of the current interval and queries merge the summaries of the
+intervals overlapping the requested window. Intervals older than the
+ring are expired. Pushes and queries both rotate the ring, so callers
+sharing a WindowedSketch between goroutines must serialize all calls.
+*/
+type WindowedSketch struct {
+	// Now tells which interval a push belongs to and where the queried
+	// window ends. It defaults to time.Now.
+	Now func() time.Time
+	// Policy is copied into the sketch of every interval when the
+	// interval starts, intervals already running keep their own.
+	Policy InputPolicy
+
+	eps         float64
+	maxElements int64
+	interval    time.Duration
+	buckets     []windowedBucket
+	// expired counts the invalid inputs of expired intervals.
+	expired InvalidInputs
+}
+
+/*
+NewWindowed returns a new WindowedSketch covering numIntervals intervals
+of the given length. Each interval is summarized by a Sketch with the
+given eps and maxElements.
+*/
+func NewWindowed(eps float64, maxElements int64, interval time.Duration, numIntervals int) (*WindowedSketch, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: interval should be > 0, got %v", ErrInvalidArgument, interval)
+	}
+	if numIntervals <= 0 {
+		return nil, fmt.Errorf("%w: numIntervals should be > 0, got %v", ErrInvalidArgument, numIntervals)
+	}
+	// Intervals get their sketches lazily, catch bad eps and maxElements here.
+	if _, err := New(eps, maxElements); err != nil {
+		return nil, err
+	}
+	return &WindowedSketch{
+		Now:         time.Now,
+		Policy:      defaultInputPolicy,
+		eps:         eps,
+		maxElements: maxElements,
+		interval:    interval,
+		buckets:     make([]windowedBucket, numIntervals),
+	}, nil
+}
+
+// expire drops the sketches of intervals that fell out of the ring.
+func (ws *WindowedSketch) expire(now time.Time) {
+	oldest := now.Truncate(ws.interval).Add(-time.Duration(len(ws.buckets)-1) * ws.interval)
+	for i := range ws.buckets {
+		if b := &ws.buckets[i]; b.sketch != nil && b.start.Before(oldest) {
+			ws.retire(b)
+		}
+	}
+}
+
+// retire empties a bucket, keeping the counts of its invalid inputs.
+func (ws *WindowedSketch) retire(b *windowedBucket) {
+	ws.expired.add(b.sketch.InvalidInputs())
+	*b = windowedBucket{}
+}
+
+// InvalidInputs returns the counts of invalid inputs of all intervals so far.
+func (ws *WindowedSketch) InvalidInputs() InvalidInputs {
+	invalid := ws.expired
+	for _, b := range ws.buckets {
+		if b.sketch != nil {
+			invalid.add(b.sketch.InvalidInputs())
+		}
+	}
+	return invalid
+}
+
+/*
+Push a value and a weight into the sketch of the current interval. If the
+clock stepped back so far that the interval has already expired, the push
+fails and the newer interval is kept.
+*/
+func (ws *WindowedSketch) Push(value float64, weight float64) error {
+	now := ws.Now()
+	ws.expire(now)
+
+	start := now.Truncate(ws.interval)
+	idx := int((start.UnixNano() / int64(ws.interval)) % int64(len(ws.buckets)))
+	if idx < 0 {
+		idx += len(ws.buckets)
+	}
+	b := &ws.buckets[idx]
+	if b.sketch != nil && start.Before(b.start) {
+		// The clock stepped back by more than the ring, the interval expired.
+		return fmt.Errorf("interval %v is older than the ring ending at %v", start, b.start)
+	}
+	if b.sketch == nil || !b.start.Equal(start) {
+		sketch, err := New(ws.eps, ws.maxElements)
+		if err != nil {
+			return err
+		}
+		sketch.Policy = ws.Policy
+		if b.sketch != nil {
+			ws.retire(b)
+		}
+		*b = windowedBucket{start: start, sketch: sketch}
+	}
+	return b.sketch.Push(value, weight)
+}
+
+/*
+Summary returns the merged summary of the intervals overlapping the
+trailing window ending now. Windows are rounded up to whole intervals and
+clipped to the length of the ring.
+*/
+func (ws *WindowedSketch) Summary(window time.Duration) *Summary {
+	now := ws.Now()
+	ws.expire(now)
+
+	cutoff := now.Add(-window)
+	merged := newSummary()
+	for _, b := range ws.buckets {
+		if b.sketch == nil || b.start.After(now) || !b.start.Add(ws.interval).After(cutoff) {
+			continue
+		}
+		merged.Merge(b.sketch.Snapshot())
+	}
+	return merged
+}
+
+/*
+Quantile returns the value for quantile q over the trailing window. Every
+call merges the snapshots of the intervals, so its cost grows with the
+size of their summaries, not with the number of elements in the window.
+*/
+func (ws *WindowedSketch) Quantile(window time.Duration, q float64) (float64, error) {
+	return ws.Summary(window).Quantile(q)
+}
+
+/*
+GenerateQuantiles generates the requested number of quantiles over the
+trailing window, see Summary.GenerateQuantiles.
+*/
+func (ws *WindowedSketch) GenerateQuantiles(window time.Duration, numQuantiles int64) []float64 {
+	return ws.Summary(window).GenerateQuantiles(numQuantiles)
+}
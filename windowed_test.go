@@ -0,0 +1,136 @@
+package quantiles
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestWindowedSketchInvalid(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewWindowed(0.01, 1000, 0, 5)
+	assert.Error(err)
+	_, err = NewWindowed(0.01, 1000, time.Minute, 0)
+	assert.Error(err)
+	_, err = NewWindowed(0, 1000, time.Minute, 5)
+	assert.Error(err)
+}
+
+func TestWindowedSketch(t *testing.T) {
+	assert := assert.New(t)
+	clock := &fakeClock{now: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ws, err := NewWindowed(0.01, 1000, time.Minute, 5)
+	assert.NoError(err)
+	ws.Now = clock.Now
+
+	// Minute i holds the values [100*i, 100*i+100).
+	for minute := 0; minute < 7; minute++ {
+		for i := 0; i < 100; i++ {
+			assert.NoError(ws.Push(float64(100*minute+i), 1))
+			clock.Advance(time.Minute / 100)
+		}
+	}
+	clock.Advance(-time.Second)
+
+	// The current minute only.
+	sum := ws.Summary(time.Second)
+	assert.Equal(100.0, sum.TotalWeight())
+	assert.Equal(600.0, sum.MinValue())
+	assert.Equal(699.0, sum.MaxValue())
+
+	// Windows are rounded up to whole intervals.
+	sum = ws.Summary(90 * time.Second)
+	assert.Equal(200.0, sum.TotalWeight())
+	assert.Equal(500.0, sum.MinValue())
+	assert.Equal(uint64(200), sum.n)
+	q, err := ws.Quantile(90*time.Second, 0.5)
+	assert.NoError(err)
+	assert.InDelta(600, q, 2)
+
+	// Windows are clipped to the ring, the first two minutes have expired.
+	sum = ws.Summary(time.Hour)
+	assert.Equal(500.0, sum.TotalWeight())
+	assert.Equal(200.0, sum.MinValue())
+	quantiles := ws.GenerateQuantiles(time.Hour, 5)
+	assert.Equal(6, len(quantiles))
+	assert.Equal(200.0, quantiles[0])
+	assert.Equal(699.0, quantiles[5])
+
+	// Intervals that expired can't be pushed into once the clock steps back.
+	clock.Advance(-5 * time.Minute)
+	assert.Error(ws.Push(-1, 1))
+	clock.Advance(time.Minute)
+	assert.NoError(ws.Push(-1, 1))
+	clock.Advance(4 * time.Minute)
+	sum = ws.Summary(time.Second)
+	assert.Equal(100.0, sum.TotalWeight())
+	assert.Equal(600.0, sum.MinValue())
+
+	// Nothing left after the ring has rotated.
+	clock.Advance(10 * time.Minute)
+	assert.Equal(0.0, ws.Summary(time.Hour).TotalWeight())
+	q, err = ws.Quantile(time.Hour, 0.5)
+	assert.NoError(err)
+	assert.Equal(0.0, q)
+	for _, b := range ws.buckets {
+		assert.Nil(b.sketch)
+	}
+}
+
+func TestWindowedSketchPolicy(t *testing.T) {
+	assert := assert.New(t)
+	clock := &fakeClock{now: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ws, err := NewWindowed(0.01, 1000, time.Minute, 2)
+	assert.NoError(err)
+	ws.Now = clock.Now
+	ws.Policy.NaNValues = RejectInput
+
+	assert.True(errors.Is(ws.Push(math.NaN(), 1), ErrInvalidInput))
+	assert.NoError(ws.Push(1, -1))
+	assert.Equal(InvalidInputs{Rejected: 1, Dropped: 1}, ws.InvalidInputs())
+
+	// The counts outlive the intervals they happened in.
+	clock.Advance(10 * time.Minute)
+	assert.NoError(ws.Push(1, 1))
+	assert.Equal(InvalidInputs{Rejected: 1, Dropped: 1}, ws.InvalidInputs())
+}
+
+func BenchmarkWindowedQuantile(b *testing.B) {
+	clock := &fakeClock{now: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ws, err := NewWindowed(0.01, 1<<20, time.Minute, 5)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ws.Now = clock.Now
+	for i := 0; i < 5000000; i++ {
+		if err := ws.Push(rand.Float64(), 1); err != nil {
+			b.Fatal(err)
+		}
+		if i%1000000 == 0 {
+			clock.Advance(time.Minute)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ws.Quantile(5*time.Minute, 0.99); err != nil {
+			b.Fatal(err)
+		}
+	}
+}